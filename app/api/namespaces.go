@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
@@ -11,12 +12,22 @@ const (
 	developmentNamespaceType = "development"
 )
 
-// GetNamespaces retrieves all the namespaces
-func GetNamespaces(baseURL, token string, logger *slog.Logger) ([]model.Namespace, error) {
-	namespacesURL := fmt.Sprintf("https://%s/%s?type=%s", baseURL, namespacesAPIPath, developmentNamespaceType)
+// GetNamespaces retrieves all the namespaces. If the response is paginated, every page is requested
+func GetNamespaces(ctx context.Context, baseURL, token string, opts Options, logger *slog.Logger) ([]model.Namespace, error) {
+	namespacesURL := fmt.Sprintf("https://%s%s?type=%s", baseURL, namespacesAPIPath, developmentNamespaceType)
 	var namespaces []model.Namespace
-	if err := sendRequest(namespacesURL, token, &namespaces, logger); err != nil {
-		return nil, err
+	pages := 0
+	for namespacesURL != "" {
+		var page []model.Namespace
+		next, err := sendRequest(ctx, namespacesURL, token, &page, opts, logger)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, page...)
+		pages++
+		namespacesURL = next
 	}
+
+	logger.Info(fmt.Sprintf("Retrieved %d namespaces in %d pages from the Okteto API", len(namespaces), pages))
 	return namespaces, nil
 }
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestServer starts an HTTPS server with the given handler and returns it with the options trusting its certificate
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, Options) {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return server, Options{RootCAs: pool}
+}
+
+func testHost(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parsing the URL of the test server: %s", err)
+	}
+
+	return u.Host
+}
+
+func TestGetNamespacesPaginated(t *testing.T) {
+	server, opts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("page %q sent with Authorization %q", r.URL.Query().Get("page"), got)
+		}
+		if r.URL.Path != namespacesAPIPath || r.URL.Query().Get("type") != developmentNamespaceType {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s?type=%s&page=2>; rel="next"`, namespacesAPIPath, developmentNamespaceType))
+			fmt.Fprint(w, `[{"name": "cindy", "status": "Active"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"name": "rberrelleza", "status": "Sleeping"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	namespaces, err := GetNamespaces(context.Background(), testHost(t, server), "secret", opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("GetNamespaces returned an error: %s", err)
+	}
+
+	var names []string
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	if got := strings.Join(names, ","); got != "cindy,rberrelleza" {
+		t.Errorf("got namespaces %q, want both pages", got)
+	}
+}
+
+func TestGetNamespacesRejectsNextPageOnAnotherHost(t *testing.T) {
+	var otherRequests atomic.Int32
+	other, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		otherRequests.Add(1)
+		fmt.Fprint(w, `[]`)
+	})
+
+	server, opts := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next"`, other.URL, namespacesAPIPath))
+		fmt.Fprint(w, `[{"name": "cindy"}]`)
+	})
+
+	_, err := GetNamespaces(context.Background(), testHost(t, server), "secret", opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		t.Fatal("GetNamespaces followed a next page on another host")
+	}
+	if otherRequests.Load() > 0 {
+		t.Errorf("the other host received %d requests", otherRequests.Load())
+	}
+}
@@ -1,50 +1,292 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 const (
 	// namespacesAPIPath is the path to the namespaces endpoint
 	namespacesAPIPath = "/api/v0/namespaces"
+
+	// retryInitialInterval is the wait before the first retry of a failed request. It doubles on every retry
+	retryInitialInterval = time.Second
+
+	// maxRetryAfter caps the wait requested by the Retry-After header of a rate limited response, so a misbehaving
+	// proxy cannot stall the run for hours
+	maxRetryAfter = 5 * time.Minute
+
+	// retryJitter is the maximum fraction of the wait randomly added to each retry, so the tools throttled at the
+	// same time do not retry at the same time
+	retryJitter = 0.5
 )
 
-func sendRequest(url, token string, response interface{}, logger *slog.Logger) error {
-	req, err := http.NewRequest("GET", url, nil)
+// Options configures the requests sent to the Okteto API
+type Options struct {
+	// Timeout is the timeout of each HTTP request
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a failed request is retried
+	MaxRetries int
+
+	// InsecureSkipVerify disables the verification of the TLS certificate of the Okteto API
+	InsecureSkipVerify bool
+
+	// RootCAs are the certificate authorities trusted to verify the Okteto API. When nil, the system pool is used
+	RootCAs *x509.CertPool
+
+	// Headers are added to every request, e.g. the ones required by a proxy in front of the Okteto API
+	Headers http.Header
+}
+
+// ParseHeaders returns the headers of the given comma-separated list of "Name: value" pairs
+func ParseHeaders(list string) (http.Header, error) {
+	headers := make(http.Header)
+	for i, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			// The value is not included in the error, since it is usually a credential
+			return nil, fmt.Errorf("invalid header number %d: must be \"Name: value\"", i+1)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+
+	return headers, nil
+}
+
+// LoadCertPool returns a certificate pool with the system certificate authorities and the PEM certificates in the given file
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
 	if err != nil {
-		logger.Error("Error creating request")
-		return err
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	return pool, nil
+}
+
+// statusError is returned when the Okteto API responds with an unexpected HTTP status
+type statusError struct {
+	statusCode int
+
+	// retryAfter is the wait requested by the Retry-After header of the response, if any
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request failed with HTTP status code %d", e.statusCode)
+}
 
-	// Create an HTTP client and send the request
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// sendRequest sends a GET request to url and decodes the JSON response into response.
+// It returns the URL of the next page of results if the response is paginated, or an empty string otherwise.
+// Network errors, server errors and rate limited requests are retried with exponential backoff until opts.MaxRetries is reached or ctx is done
+func sendRequest(ctx context.Context, url, token string, response interface{}, opts Options, logger *slog.Logger) (string, error) {
+	client := newHTTPClient(opts)
+
+	interval := retryInitialInterval
+	for attempt := 0; ; attempt++ {
+		next, err := doRequest(ctx, client, url, token, opts.Headers, response, logger)
+		if err == nil || ctx.Err() != nil || !isRetriable(err) || attempt >= opts.MaxRetries {
+			return next, err
+		}
+
+		delay := interval
+		var statusErr *statusError
+		rateLimited := errors.As(err, &statusErr) && statusErr.statusCode == http.StatusTooManyRequests
+		if rateLimited && statusErr.retryAfter > 0 {
+			delay = statusErr.retryAfter
+			if delay > maxRetryAfter {
+				logger.Warn(fmt.Sprintf("The Okteto API asked to retry in %s, waiting %s instead", delay, maxRetryAfter))
+				delay = maxRetryAfter
+			}
+		}
+		delay = wait.Jitter(delay, retryJitter).Round(time.Millisecond)
+		if rateLimited {
+			logger.Warn(fmt.Sprintf("The Okteto API is rate limiting the requests, retrying in %s", delay))
+		} else {
+			logger.Warn(fmt.Sprintf("Request to the Okteto API failed, retrying in %s: %s", delay, err))
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+		interval *= 2
+	}
+}
+
+// newHTTPClient returns the HTTP client used to send the requests to the Okteto API
+func newHTTPClient(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY are honored, so the Okteto API can be reached through a corporate proxy.
+	// They are read when the client is created, since http.ProxyFromEnvironment only reads them once per process
+	proxy := httpproxy.FromEnvironment().ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
 	}
+	if opts.InsecureSkipVerify || opts.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			RootCAs:            opts.RootCAs,
+		}
+	}
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+	}
+}
+
+// doRequest sends a single GET request to url with the given headers and decodes the JSON response into response.
+// It returns the URL of the next page of results, if any
+func doRequest(ctx context.Context, client *http.Client, url, token string, headers http.Header, response interface{}, logger *slog.Logger) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		logger.Error("Error creating request")
+		return "", err
+	}
+
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error("Error sending request")
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	// Check if the HTTP status is OK (200)
 	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return "", &statusError{statusCode: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		}
 		logger.Error(fmt.Sprintf("Request failed. HTTP status code: %d", resp.StatusCode))
-		return err
+		return "", &statusError{statusCode: resp.StatusCode}
 	}
 
 	decoder := json.NewDecoder(resp.Body)
 	err = decoder.Decode(&response)
 	if err != nil {
 		logger.Error("Error decoding response")
-		return err
+		return "", err
+	}
+
+	return nextPageURL(req.URL, resp.Header)
+}
+
+// nextPageURL returns the URL of the "next" relation of the Link header (RFC 8288), resolved against requestURL.
+// It returns an empty string if the response is not paginated or this is the last page.
+// The token is sent to the next page too, so it must be on the same scheme and host as requestURL
+func nextPageURL(requestURL *url.URL, header http.Header) (string, error) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				param = strings.ReplaceAll(strings.TrimSpace(param), `"`, "")
+				if param != "rel=next" {
+					continue
+				}
+
+				next, err := requestURL.Parse(strings.Trim(target, "<>"))
+				if err != nil {
+					return "", fmt.Errorf("invalid next page URL %q: %w", target, err)
+				}
+				if next.Scheme != requestURL.Scheme || next.Host != requestURL.Host {
+					return "", fmt.Errorf("the next page is on %s://%s instead of %s://%s, refusing to send the token there", next.Scheme, next.Host, requestURL.Scheme, requestURL.Host)
+				}
+				return next.String(), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// parseRetryAfter returns the wait requested by the given Retry-After header, either in seconds or as an HTTP date.
+// It returns 0 if the header is not set or is not valid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// isRetriable returns true if the request failed because of a transient network error, a server error or rate limiting.
+// Errors that would fail again, such as an untrusted certificate or an invalid URL, are not retried
+func isRetriable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError || statusErr.statusCode == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary
 	}
 
-	return nil
+	// The connection was refused or dropped, e.g. while the Okteto API is restarting
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
 }
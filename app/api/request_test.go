@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		noProxy string
+		want    string
+	}{
+		{name: "HTTPS_PROXY", want: "http://proxy.corp.example.com:3128"},
+		{name: "NO_PROXY", noProxy: ".example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HTTPS_PROXY", "http://proxy.corp.example.com:3128")
+			t.Setenv("NO_PROXY", tt.noProxy)
+
+			transport, ok := newHTTPClient(Options{}).Transport.(*http.Transport)
+			if !ok {
+				t.Fatal("the HTTP client does not use an *http.Transport")
+			}
+			req, err := http.NewRequest("GET", "https://okteto.example.com/api/v0/namespaces", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proxyURL, err := transport.Proxy(req)
+			if err != nil {
+				t.Fatalf("Proxy returned an error: %s", err)
+			}
+			got := ""
+			if proxyURL != nil {
+				got = proxyURL.String()
+			}
+			if got != tt.want {
+				t.Errorf("the request goes through proxy %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	requestURL, _ := url.Parse("https://okteto.example.com/api/v0/namespaces?type=development")
+	tests := []struct {
+		name    string
+		link    string
+		want    string
+		wantErr bool
+	}{
+		{name: "no link"},
+		{name: "last page", link: `</api/v0/namespaces?page=1>; rel="prev"`},
+		{name: "relative", link: `</api/v0/namespaces?page=2>; rel="next"`, want: "https://okteto.example.com/api/v0/namespaces?page=2"},
+		{name: "same host", link: `<https://okteto.example.com/api/v0/namespaces?page=2>; rel=next`, want: "https://okteto.example.com/api/v0/namespaces?page=2"},
+		{name: "another host", link: `<https://attacker.example.com/api/v0/namespaces?page=2>; rel="next"`, wantErr: true},
+		{name: "another port", link: `<https://okteto.example.com:8443/api/v0/namespaces?page=2>; rel="next"`, wantErr: true},
+		{name: "plain HTTP", link: `<http://okteto.example.com/api/v0/namespaces?page=2>; rel="next"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			if tt.link != "" {
+				header.Set("Link", tt.link)
+			}
+
+			got, err := nextPageURL(requestURL, header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextPageURL returned error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nextPageURL returned %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "server error", err: &statusError{statusCode: http.StatusBadGateway}, want: true},
+		{name: "rate limited", err: &statusError{statusCode: http.StatusTooManyRequests}, want: true},
+		{name: "unauthorized", err: &statusError{statusCode: http.StatusUnauthorized}},
+		{name: "timeout", err: &url.Error{Op: "Get", Err: context.DeadlineExceeded}, want: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, want: true},
+		{name: "connection closed", err: &url.Error{Op: "Get", Err: io.EOF}, want: true},
+		{name: "temporary DNS error", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{IsTemporary: true}}}, want: true},
+		{name: "unknown host", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{IsNotFound: true}}}},
+		{name: "untrusted certificate", err: &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}},
+		{name: "unsupported scheme", err: &url.Error{Op: "Get", Err: errors.New("unsupported protocol scheme \"ftp\"")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetriable(tt.err); got != tt.want {
+				t.Errorf("isRetriable(%v) is %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendRequestDoesNotRetryUntrustedCertificate(t *testing.T) {
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	start := time.Now()
+	var response []interface{}
+	_, err := sendRequest(context.Background(), server.URL, "secret", &response, Options{MaxRetries: 3}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		t.Fatalf("sendRequest returned %v, want a certificate verification error", err)
+	}
+	if elapsed := time.Since(start); elapsed >= retryInitialInterval {
+		t.Errorf("sendRequest took %s, want it to fail without retrying", elapsed)
+	}
+}
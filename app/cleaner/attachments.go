@@ -0,0 +1,36 @@
+package cleaner
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// getAttachedPVs returns the names of the PersistentVolumes referenced by a VolumeAttachment, mapped to the node they are
+// attached to. A VolumeAttachment exists until the volume is detached, so the PVs still detaching are included too.
+// VolumeAttachments are cluster-scoped, so they are listed once for all the namespaces of the cluster
+func getAttachedPVs(ctx context.Context, clientset kubernetes.Interface, pageSize int64) (map[string]string, error) {
+	opts := metav1.ListOptions{
+		Limit: pageSize,
+	}
+
+	attached := make(map[string]string)
+	for {
+		attachments, err := clientset.StorageV1().VolumeAttachments().List(ctx, opts)
+		if err != nil {
+			return nil, CheckForbidden(err, "list", "storage.k8s.io", "volumeattachments")
+		}
+
+		for _, attachment := range attachments.Items {
+			if pv := attachment.Spec.Source.PersistentVolumeName; pv != nil {
+				attached[*pv] = attachment.Spec.NodeName
+			}
+		}
+
+		if attachments.Continue == "" {
+			return attached, nil
+		}
+		opts.Continue = attachments.Continue
+	}
+}
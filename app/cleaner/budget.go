@@ -0,0 +1,47 @@
+package cleaner
+
+import "sync"
+
+// Budget caps the number of PVCs deleted in a run to limit the blast radius of a misconfiguration
+type Budget struct {
+	// max is the maximum number of deletions. Zero means unlimited
+	max int
+
+	// mu guards used, because deletions that fail release their reservation concurrently
+	mu   sync.Mutex
+	used int
+}
+
+// NewBudget returns a Budget allowing max deletions. Zero means unlimited
+func NewBudget(max int) *Budget {
+	return &Budget{max: max}
+}
+
+// Reached returns true once the reserved deletions reach the maximum, so a run deleting exactly max PVCs is reported
+func (b *Budget) Reached() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.max > 0 && b.used >= b.max
+}
+
+// take reserves a deletion and returns false if the budget is exhausted
+func (b *Budget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && b.used >= b.max {
+		return false
+	}
+
+	b.used++
+	return true
+}
+
+// release returns a deletion reserved with take that was not performed
+func (b *Budget) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used--
+}
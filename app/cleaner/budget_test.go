@@ -0,0 +1,42 @@
+package cleaner
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBudgetReachedWithExactlyMaxDeletions(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newTestPVC("data", map[string]string{"dev.okteto.com": "true"}))
+
+	opts := newTestOptions()
+	opts.MaxDeletions = 1
+	c := New(clientset, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.Namespaces = []model.Namespace{{Name: testNamespace}}
+	report, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned an error: %s", err)
+	}
+
+	if report.Deleted != 1 {
+		t.Errorf("deleted %d PVCs, want 1", report.Deleted)
+	}
+	if !c.Budget.Reached() {
+		t.Error("the budget is not reached after deleting MAX_DELETIONS PVCs")
+	}
+}
+
+func TestBudgetRelease(t *testing.T) {
+	b := NewBudget(1)
+	if !b.take() {
+		t.Fatal("the first deletion was refused")
+	}
+	b.release()
+	if b.Reached() {
+		t.Error("the budget is reached after releasing the only deletion")
+	}
+}
@@ -0,0 +1,250 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Cleaner deletes the unused dev PVCs of a list of namespaces of a Kubernetes cluster.
+// It only talks to the Kubernetes API, so it can be used with any clientset, such as a fake one
+type Cleaner struct {
+	clientset kubernetes.Interface
+	opts      *Options
+	logger    *slog.Logger
+
+	// DynamicClient creates the VolumeSnapshots. It is only needed when snapshots are enabled
+	DynamicClient dynamic.Interface
+
+	// Limiter throttles the deletions, and Budget stops them once the maximum is reached.
+	// They can be shared by the cleaners of several Okteto instances
+	Limiter *rate.Limiter
+	Budget  *Budget
+
+	// InstanceURL is the URL of the Okteto instance the namespaces belong to, recorded in the results
+	InstanceURL string
+
+	// Namespaces are the namespaces to clean up
+	Namespaces []model.Namespace
+}
+
+// New returns a Cleaner deleting the unused dev PVCs with clientset according to opts
+func New(clientset kubernetes.Interface, opts *Options, logger *slog.Logger) *Cleaner {
+	return &Cleaner{
+		clientset: clientset,
+		opts:      opts,
+		logger:    logger,
+		Limiter:   NewDeleteLimiter(opts.DeleteQPS),
+		Budget:    NewBudget(opts.MaxDeletions),
+	}
+}
+
+// Run processes the namespaces of the cleaner in order and returns the report of the run, without logging nor sending it.
+// It returns an error if the cluster-wide resources or the state could not be read, or if the job cannot list the PVCs
+func (c *Cleaner) Run(ctx context.Context) (Report, error) {
+	start := time.Now()
+	var total Report
+	// The namespaces are sorted on a copy, so the slice of the caller keeps its order
+	namespaces := slices.Clone(c.Namespaces)
+	sortNamespaces(namespaces, c.opts.SortNamespaces)
+
+	cluster, err := getClusterScan(ctx, c.clientset, c.opts)
+	if err != nil {
+		return total, err
+	}
+
+	var grace graceTracker = annotationTracker{clientset: c.clientset}
+	var state *configMapState
+	if c.opts.StateConfigMap != "" && c.opts.GracePeriod > 0 {
+		state, err = loadConfigMapState(ctx, c.clientset, c.opts.StateNamespace, c.opts.StateConfigMap)
+		if err != nil {
+			return total, fmt.Errorf("there was an error loading the state from ConfigMap %s/%s: %w", c.opts.StateNamespace, c.opts.StateConfigMap, err)
+		}
+		c.logger.Info(fmt.Sprintf("Tracking the grace periods in ConfigMap %s/%s", c.opts.StateNamespace, c.opts.StateConfigMap))
+		grace = state
+	}
+
+	for _, ns := range namespaces {
+		if ctx.Err() != nil {
+			c.logger.Warn(fmt.Sprintf("%s, stopping before namespace %q after processing %d namespaces", stopCause(ctx), ns.Name, len(total.Namespaces)))
+			break
+		}
+
+		if c.Budget.Reached() {
+			c.logger.Warn(fmt.Sprintf("Stopping before namespace %q because the maximum number of deletions was reached", ns.Name))
+			break
+		}
+
+		if c.opts.ExcludeNamespaces[ns.Name] {
+			if isSystemNamespace(ns.Name) {
+				c.logger.Info(fmt.Sprintf("Skipping namespace %q because it is a system namespace", ns.Name))
+			} else {
+				c.logger.Info(fmt.Sprintf("Skipping namespace %q because it is in the exclude list", ns.Name))
+			}
+			continue
+		}
+
+		if c.opts.OnlySleptOlderThan > 0 {
+			// The last update of a sleeping namespace is the time it went to sleep
+			if !ns.IsSleeping() {
+				c.logger.Info(fmt.Sprintf("Skipping namespace %q because it is not sleeping", ns.Name))
+				continue
+			}
+			if slept := time.Since(ns.LastUpdated); ns.LastUpdated.IsZero() || slept < c.opts.OnlySleptOlderThan {
+				c.logger.Info(fmt.Sprintf("Skipping namespace %q because it has not been sleeping for %s", ns.Name, c.opts.OnlySleptOlderThan))
+				continue
+			}
+		} else if ns.IsSleeping() && !c.opts.DeleteInSlept {
+			// Sleeping namespaces have no pods, so their dev PVCs would look unused although the dev environment still needs them
+			c.logger.Info(fmt.Sprintf("Skipping namespace %q because it is sleeping", ns.Name))
+			continue
+		}
+
+		if ns.IsDeleting() {
+			c.logger.Info(fmt.Sprintf("Skipping namespace %q because Okteto is deleting it", ns.Name))
+			continue
+		}
+
+		k8sNamespace, err := c.clientset.CoreV1().Namespaces().Get(ctx, ns.Name, metav1.GetOptions{})
+		if err != nil {
+			// The age of the namespace is unknown, so it is not processed if it could be too recent
+			if c.opts.MinNamespaceAge > 0 {
+				c.logger.Warn(fmt.Sprintf("Skipping namespace %q because its creation time could not be read: %s", ns.Name, err))
+				continue
+			}
+			c.logger.Debug(fmt.Sprintf("Could not check if namespace %q is terminating: %s", ns.Name, err))
+		} else if isNamespaceTerminating(k8sNamespace) {
+			c.logger.Info(fmt.Sprintf("Skipping namespace %q because it is being deleted", ns.Name))
+			continue
+		} else if age := time.Since(k8sNamespace.CreationTimestamp.Time); age < c.opts.MinNamespaceAge {
+			c.logger.Info(fmt.Sprintf("Skipping namespace %q because it was created %s ago, more recently than %s", ns.Name, age.Round(time.Second), c.opts.MinNamespaceAge))
+			continue
+		}
+
+		if c.opts.NamespaceJitter > 0 {
+			// wait.Jitter returns a random duration between namespaceJitter and twice it, so the delay is up to namespaceJitter
+			delay := wait.Jitter(c.opts.NamespaceJitter, 1) - c.opts.NamespaceJitter
+			c.logger.Debug(fmt.Sprintf("Waiting %s before processing namespace %q", delay.Round(time.Millisecond), ns.Name))
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			if ctx.Err() != nil {
+				c.logger.Warn(fmt.Sprintf("%s, stopping before namespace %q after processing %d namespaces", stopCause(ctx), ns.Name, len(total.Namespaces)))
+				break
+			}
+		}
+
+		// The current namespace is always completed, even if a shutdown signal is received while processing it,
+		// unless it takes longer than the namespace timeout. When the deletions are confirmed interactively there is
+		// no timeout, since the time spent answering the prompts would count against it
+		nsCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+		if c.opts.NamespaceTimeout > 0 && !c.prompting() {
+			nsCtx, cancel = context.WithTimeout(nsCtx, c.opts.NamespaceTimeout)
+		}
+		nsStart := time.Now()
+		result := processNamespace(nsCtx, ctx, c.clientset, c.DynamicClient, c.opts, c.Limiter, c.Budget, grace, cluster, ns.Name, c.logger)
+		result.Duration = time.Since(nsStart)
+		c.logger.Debug(fmt.Sprintf("Processed namespace %q in %s", ns.Name, result.Duration.Round(time.Millisecond)))
+		if errors.Is(nsCtx.Err(), context.DeadlineExceeded) {
+			c.logger.Error(fmt.Sprintf("Processing namespace %q timed out after %s, moving on to the next namespace", ns.Name, c.opts.NamespaceTimeout))
+			result.addError(fmt.Errorf("timed out after %s", c.opts.NamespaceTimeout))
+		}
+		cancel()
+		if len(result.Deleted) > 0 {
+			c.logger.Info(fmt.Sprintf("%s %s across %d PVCs in namespace %q", reclaimVerb(c.opts.DryRun), result.Reclaimed.String(), len(result.Deleted), ns.Name))
+		}
+		result.Instance = c.InstanceURL
+		total.add(result)
+
+		// The job is usually granted the same permissions in every namespace, so when it cannot list the pods or the
+		// PVCs of the first one the run is stopped instead of failing in each of them
+		if len(total.Namespaces) == 1 && result.listForbidden != nil {
+			return total, fmt.Errorf("the namespaces can't be checked: %w", result.listForbidden)
+		}
+
+		c.logger.Info("-----------------------------------------------")
+	}
+
+	// The state is saved even if the run was interrupted, so the grace periods started are not lost
+	if state != nil && !c.opts.DryRun {
+		if err := state.save(context.WithoutCancel(ctx)); err != nil {
+			c.logger.Error(fmt.Sprintf("There was an error saving the state to ConfigMap %s/%s: %s", c.opts.StateNamespace, c.opts.StateConfigMap, err))
+			total.Errors++
+		}
+	}
+
+	if c.opts.DeleteOrphanPVs && ctx.Err() == nil && total.Deleted > 0 {
+		deletedPVs, pvErrors := deleteOrphanPVs(ctx, c.clientset, total.deletedClaims(), c.opts.DryRun, c.opts.PageSize, c.logger)
+		total.DeletedPVs += deletedPVs
+		total.Errors += pvErrors
+		c.logger.Info("-----------------------------------------------")
+	}
+
+	total.Duration = time.Since(start)
+	return total, nil
+}
+
+// prompting returns true if the deletions are confirmed interactively
+func (c *Cleaner) prompting() bool {
+	return c.opts.Interactive && !c.opts.AssumeYes
+}
+
+// clusterScan are the cluster-wide resources checked for every dev PVC. They are listed once at the start of the run
+// instead of for each namespace, to limit the load on the API server
+type clusterScan struct {
+	// attachedPVs are the volumes attached to a node, so a volume still being detached when the run starts is kept
+	attachedPVs map[string]string
+
+	// mounts are the volumes mounted by the pods of the whole cluster, that may mount the storage of a dev PVC through their own claims
+	mounts clusterMounts
+
+	pvs pvIndex
+}
+
+// getClusterScan lists the cluster-wide resources needed by the checks enabled in opts
+func getClusterScan(ctx context.Context, clientset kubernetes.Interface, opts *Options) (clusterScan, error) {
+	var scan clusterScan
+	var err error
+	if opts.CheckVolumeAttachments {
+		scan.attachedPVs, err = getAttachedPVs(ctx, clientset, opts.PageSize)
+		if err != nil {
+			return scan, fmt.Errorf("there was an error listing the VolumeAttachments: %w", err)
+		}
+	}
+
+	if opts.ScanAllMounts {
+		scan.mounts, err = getClusterMounts(ctx, clientset, opts.MountedPodPhases, opts.PageSize)
+		if err != nil {
+			return scan, fmt.Errorf("there was an error listing the volumes mounted in the cluster: %w", err)
+		}
+	}
+
+	if opts.CheckSharedPVs {
+		scan.pvs, err = getPVIndex(ctx, clientset, opts.PageSize)
+		if err != nil {
+			return scan, fmt.Errorf("there was an error listing the PersistentVolumes: %w", err)
+		}
+	}
+
+	return scan, nil
+}
+
+// stopCause describes why ctx is done: the run timed out or the process received a shutdown signal
+func stopCause(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "The run timed out"
+	}
+
+	return "Received a shutdown signal"
+}
@@ -0,0 +1,139 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "cindy"
+
+func newTestPVC(name string, labels map[string]string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			UID:       types.UID("uid-" + name),
+			Labels:    labels,
+		},
+	}
+}
+
+func newTestPod(name, claimName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func newTestOptions() *Options {
+	return &Options{
+		DevPVCLabelSelector: "dev.okteto.com=true",
+		MountedPodPhases:    map[corev1.PodPhase]bool{corev1.PodRunning: true, corev1.PodPending: true},
+		Concurrency:         1,
+	}
+}
+
+func TestCleanerRun(t *testing.T) {
+	devLabels := map[string]string{"dev.okteto.com": "true"}
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		deleteErr   error
+		wantDeleted int
+		wantErrors  int
+		wantSkipped []string
+		wantPVCs    []string
+	}{
+		{
+			name:        "mounted PVC is kept",
+			objects:     []runtime.Object{newTestPVC("data", devLabels), newTestPod("api", "data")},
+			wantSkipped: []string{ReasonMounted},
+			wantPVCs:    []string{"data"},
+		},
+		{
+			name:        "unmounted PVC is deleted",
+			objects:     []runtime.Object{newTestPVC("data", devLabels), newTestPod("api", "other")},
+			wantDeleted: 1,
+		},
+		{
+			name:     "no dev PVCs",
+			objects:  []runtime.Object{newTestPVC("data", map[string]string{"app": "db"})},
+			wantPVCs: []string{"data"},
+		},
+		{
+			name:       "delete error",
+			objects:    []runtime.Object{newTestPVC("data", devLabels)},
+			deleteErr:  errors.New("etcd is unavailable"),
+			wantErrors: 1,
+			wantPVCs:   []string{"data"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+			clientset := fake.NewSimpleClientset(append(tt.objects, ns)...)
+			if tt.deleteErr != nil {
+				clientset.PrependReactor("delete", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.deleteErr
+				})
+			}
+
+			c := New(clientset, newTestOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+			c.Namespaces = []model.Namespace{{Name: testNamespace}}
+			report, err := c.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run returned an error: %s", err)
+			}
+
+			if report.Deleted != tt.wantDeleted {
+				t.Errorf("deleted %d PVCs, want %d", report.Deleted, tt.wantDeleted)
+			}
+			if report.Errors != tt.wantErrors {
+				t.Errorf("found %d errors, want %d", report.Errors, tt.wantErrors)
+			}
+			if len(report.Namespaces) != 1 {
+				t.Fatalf("reported %d namespaces, want 1", len(report.Namespaces))
+			}
+			var skipped []string
+			for _, pvc := range report.Namespaces[0].Skipped {
+				skipped = append(skipped, pvc.Reason)
+			}
+			if !slices.Equal(skipped, tt.wantSkipped) {
+				t.Errorf("skipped PVCs with reasons %v, want %v", skipped, tt.wantSkipped)
+			}
+
+			pvcs, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("listing the PVCs: %s", err)
+			}
+			var remaining []string
+			for _, pvc := range pvcs.Items {
+				remaining = append(remaining, pvc.Name)
+			}
+			if !slices.Equal(remaining, tt.wantPVCs) {
+				t.Errorf("remaining PVCs are %v, want %v", remaining, tt.wantPVCs)
+			}
+		})
+	}
+}
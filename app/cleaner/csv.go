@@ -0,0 +1,46 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"os"
+	"time"
+)
+
+// csvHeader are the columns of the CSV report
+var csvHeader = []string{"okteto_url", "namespace", "pvc", "size", "action", "reason", "timestamp"}
+
+// WriteCSVReport writes a row to path for every dev PVC evaluated in the run. The action column takes the values of
+// the action attribute of the logs, with would-delete instead of delete in dry-run mode
+func WriteCSVReport(path string, r *Report, dryRun bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, result := range r.Namespaces {
+		for _, outcome := range result.Outcomes {
+			action := outcome.Action
+			if action == ActionDelete && dryRun {
+				action = ActionWouldDelete
+			}
+
+			row := []string{result.Instance, result.Name, outcome.Name, outcome.Size.String(), action, outcome.Reason, outcome.Timestamp.Format(time.RFC3339)}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,48 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// eventSourceComponent identifies the tool in the events it records
+	eventSourceComponent = "delete-unused-dev-volumes"
+
+	// eventReasonReclaimed is the reason of the event recorded when a dev PVC is deleted
+	eventReasonReclaimed = "DevVolumeReclaimed"
+)
+
+// recordDeletionEvent creates a Normal event in the namespace of the given PVC recording that it was deleted
+func recordDeletionEvent(ctx context.Context, clientset kubernetes.Interface, pvc corev1.PersistentVolumeClaim) error {
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", pvc.Name, now.UnixNano()),
+			Namespace: pvc.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "PersistentVolumeClaim",
+			APIVersion:      "v1",
+			Namespace:       pvc.Namespace,
+			Name:            pvc.Name,
+			UID:             pvc.UID,
+			ResourceVersion: pvc.ResourceVersion,
+		},
+		Reason:         eventReasonReclaimed,
+		Message:        fmt.Sprintf("Dev volume deleted by %s because it was not mounted in any pod", eventSourceComponent),
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	_, err := clientset.CoreV1().Events(pvc.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	return CheckForbidden(err, "create", "", "events")
+}
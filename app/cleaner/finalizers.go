@@ -0,0 +1,73 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PVCProtectionFinalizer is the finalizer Kubernetes sets to keep a PVC while a pod uses it
+const PVCProtectionFinalizer = "kubernetes.io/pvc-protection"
+
+// isOktetoFinalizer returns true if the given finalizer was set by Okteto
+func isOktetoFinalizer(finalizer string) bool {
+	domain, _, _ := strings.Cut(finalizer, "/")
+	return domain == "okteto.com" || strings.HasSuffix(domain, ".okteto.com")
+}
+
+// removeFinalizers removes from the given deleted PVC the finalizers set by Okteto and the ones in extra,
+// so that it can be garbage collected. The PVC is only patched if it still has the same UID and matches
+// the dev PVC label selector. It returns the finalizers removed
+func removeFinalizers(ctx context.Context, clientset kubernetes.Interface, pvc corev1.PersistentVolumeClaim, devPVCLabelSelector string, extra map[string]bool) ([]string, error) {
+	selector, err := labels.Parse(devPVCLabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if current.UID != pvc.UID {
+		return nil, fmt.Errorf("the PVC was recreated")
+	}
+	if !selector.Matches(labels.Set(current.Labels)) {
+		return nil, fmt.Errorf("the PVC does not match %q", devPVCLabelSelector)
+	}
+
+	var kept, removed []string
+	for _, finalizer := range current.Finalizers {
+		if isOktetoFinalizer(finalizer) || extra[finalizer] {
+			removed = append(removed, finalizer)
+			continue
+		}
+		kept = append(kept, finalizer)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	// The resource version makes the patch fail if the PVC changed since it was read
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      kept,
+			"resourceVersion": current.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(ctx, pvc.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
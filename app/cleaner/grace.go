@@ -0,0 +1,113 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unmountedSinceAnnotation is the annotation where the tool records the first time it saw a dev PVC unmounted
+const unmountedSinceAnnotation = "dev.okteto.com/unmounted-since"
+
+// graceTracker records the first time each dev PVC was seen unmounted, to enforce the grace period
+type graceTracker interface {
+	// unmountedSince returns the time the given PVC was first seen unmounted, or false if it is not recorded
+	unmountedSince(pvc corev1.PersistentVolumeClaim) (time.Time, bool)
+
+	// markUnmounted records that the given PVC is unmounted since now, unless it already has a record.
+	// It returns the time the PVC was first seen unmounted and true if the record was created by this call
+	markUnmounted(ctx context.Context, pvc corev1.PersistentVolumeClaim) (time.Time, bool, error)
+
+	// clearUnmounted removes the record of the given PVC, if it has one
+	clearUnmounted(ctx context.Context, pvc corev1.PersistentVolumeClaim) (bool, error)
+
+	// observe is called with the dev PVCs listed in each namespace
+	observe(namespace string, pvcs []corev1.PersistentVolumeClaim)
+}
+
+// annotationTracker records the grace periods in the unmounted-since annotation of each dev PVC
+type annotationTracker struct {
+	clientset kubernetes.Interface
+}
+
+func (t annotationTracker) unmountedSince(pvc corev1.PersistentVolumeClaim) (time.Time, bool) {
+	return pvcUnmountedSince(pvc)
+}
+
+func (t annotationTracker) markUnmounted(ctx context.Context, pvc corev1.PersistentVolumeClaim) (time.Time, bool, error) {
+	return markUnmounted(ctx, t.clientset, pvc.Namespace, pvc)
+}
+
+func (t annotationTracker) clearUnmounted(ctx context.Context, pvc corev1.PersistentVolumeClaim) (bool, error) {
+	return clearUnmounted(ctx, t.clientset, pvc.Namespace, pvc)
+}
+
+// observe does nothing, the annotation is removed with the PVC
+func (t annotationTracker) observe(string, []corev1.PersistentVolumeClaim) {}
+
+// pvcUnmountedSince returns the time recorded in the unmounted-since annotation of the given PVC.
+// It returns false if the annotation is not set or is not a valid RFC 3339 time
+func pvcUnmountedSince(pvc corev1.PersistentVolumeClaim) (time.Time, bool) {
+	value, ok := pvc.Annotations[unmountedSinceAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return since, true
+}
+
+// markUnmounted records in the given PVC that it is unmounted since now, unless it already has a valid record.
+// It returns the time the PVC was first seen unmounted and true if the record was created by this call
+func markUnmounted(ctx context.Context, clientset kubernetes.Interface, namespace string, pvc corev1.PersistentVolumeClaim) (time.Time, bool, error) {
+	if since, ok := pvcUnmountedSince(pvc); ok {
+		return since, false, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := patchUnmountedSince(ctx, clientset, namespace, pvc.Name, now.Format(time.RFC3339)); err != nil {
+		return time.Time{}, false, err
+	}
+
+	return now, true, nil
+}
+
+// clearUnmounted removes the unmounted-since annotation from the given PVC, if it has one, so that the
+// grace period starts again the next time the PVC is seen unmounted
+func clearUnmounted(ctx context.Context, clientset kubernetes.Interface, namespace string, pvc corev1.PersistentVolumeClaim) (bool, error) {
+	if _, ok := pvc.Annotations[unmountedSinceAnnotation]; !ok {
+		return false, nil
+	}
+
+	if err := patchUnmountedSince(ctx, clientset, namespace, pvc.Name, nil); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// patchUnmountedSince sets the unmounted-since annotation of the given PVC to value. A nil value removes the annotation
+func patchUnmountedSince(ctx context.Context, clientset kubernetes.Interface, namespace, name string, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				unmountedSinceAnnotation: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return CheckForbidden(err, "patch", "", "persistentvolumeclaims")
+}
@@ -0,0 +1,137 @@
+package cleaner
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func getTestPVC(t *testing.T, clientset *fake.Clientset, name string) *corev1.PersistentVolumeClaim {
+	t.Helper()
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting PVC %q: %s", name, err)
+	}
+
+	return pvc
+}
+
+func TestMarkUnmounted(t *testing.T) {
+	recorded := "2024-05-01T10:00:00Z"
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantCreated bool
+		wantSince   string
+	}{
+		{
+			name:        "sets the annotation when it is missing",
+			wantCreated: true,
+		},
+		{
+			name:        "leaves an existing annotation alone",
+			annotations: map[string]string{unmountedSinceAnnotation: recorded},
+			wantSince:   recorded,
+		},
+		{
+			name:        "replaces an invalid annotation",
+			annotations: map[string]string{unmountedSinceAnnotation: "yesterday"},
+			wantCreated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pvc := newTestPVC("data", nil)
+			pvc.Annotations = tt.annotations
+			clientset := fake.NewSimpleClientset(pvc)
+
+			start := time.Now().UTC().Truncate(time.Second)
+			since, created, err := markUnmounted(context.Background(), clientset, testNamespace, *pvc)
+			if err != nil {
+				t.Fatalf("markUnmounted returned an error: %s", err)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created is %t, want %t", created, tt.wantCreated)
+			}
+
+			value := getTestPVC(t, clientset, "data").Annotations[unmountedSinceAnnotation]
+			if value != since.Format(time.RFC3339) {
+				t.Errorf("annotation is %q, want the returned time %s", value, since.Format(time.RFC3339))
+			}
+			if tt.wantSince != "" && value != tt.wantSince {
+				t.Errorf("annotation is %q, want %q", value, tt.wantSince)
+			}
+			if tt.wantCreated && since.Before(start) {
+				t.Errorf("unmounted since %s, want a time after %s", since, start)
+			}
+		})
+	}
+}
+
+func TestClearUnmounted(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantCleared bool
+	}{
+		{
+			name:        "removes the annotation when the PVC is mounted again",
+			annotations: map[string]string{unmountedSinceAnnotation: "2024-05-01T10:00:00Z", "team": "web"},
+			wantCleared: true,
+		},
+		{
+			name:        "does nothing without the annotation",
+			annotations: map[string]string{"team": "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pvc := newTestPVC("data", nil)
+			pvc.Annotations = tt.annotations
+			clientset := fake.NewSimpleClientset(pvc)
+
+			cleared, err := clearUnmounted(context.Background(), clientset, testNamespace, *pvc)
+			if err != nil {
+				t.Fatalf("clearUnmounted returned an error: %s", err)
+			}
+			if cleared != tt.wantCleared {
+				t.Errorf("cleared is %t, want %t", cleared, tt.wantCleared)
+			}
+
+			annotations := getTestPVC(t, clientset, "data").Annotations
+			if _, ok := annotations[unmountedSinceAnnotation]; ok {
+				t.Errorf("the %s annotation was not removed", unmountedSinceAnnotation)
+			}
+			if annotations["team"] != "web" {
+				t.Errorf("the other annotations were changed: %v", annotations)
+			}
+		})
+	}
+}
+
+func TestRunClearsUnmountedOfMountedPVC(t *testing.T) {
+	pvc := newTestPVC("data", map[string]string{"dev.okteto.com": "true"})
+	pvc.Annotations = map[string]string{unmountedSinceAnnotation: "2024-05-01T10:00:00Z"}
+	clientset := fake.NewSimpleClientset(pvc, newTestPod("api", "data"))
+
+	opts := newTestOptions()
+	opts.GracePeriod = time.Hour
+	c := New(clientset, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.Namespaces = []model.Namespace{{Name: testNamespace}}
+	if _, err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error: %s", err)
+	}
+
+	if _, ok := getTestPVC(t, clientset, "data").Annotations[unmountedSinceAnnotation]; ok {
+		t.Errorf("the %s annotation of the mounted PVC was not removed", unmountedSinceAnnotation)
+	}
+}
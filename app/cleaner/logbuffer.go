@@ -0,0 +1,60 @@
+package cleaner
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// logBuffer keeps the log records of a worker in memory, so that they can be written together once it finishes
+// instead of interleaved with the ones of the other workers
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []bufferedRecord
+}
+
+// bufferedRecord is a log record and the handler that writes it
+type bufferedRecord struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+// logger returns a logger that records in b everything logged with parent
+func (b *logBuffer) logger(parent *slog.Logger) *slog.Logger {
+	return slog.New(&bufferedHandler{handler: parent.Handler(), buffer: b})
+}
+
+// flush writes the records of b in the order they were logged and empties it
+func (b *logBuffer) flush(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, entry := range b.entries {
+		_ = entry.handler.Handle(ctx, entry.record)
+	}
+	b.entries = nil
+}
+
+// bufferedHandler is a slog.Handler that stores the records in a logBuffer instead of writing them
+type bufferedHandler struct {
+	handler slog.Handler
+	buffer  *logBuffer
+}
+
+func (h *bufferedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *bufferedHandler) Handle(_ context.Context, record slog.Record) error {
+	h.buffer.mu.Lock()
+	defer h.buffer.mu.Unlock()
+	h.buffer.entries = append(h.buffer.entries, bufferedRecord{handler: h.handler, record: record.Clone()})
+	return nil
+}
+
+func (h *bufferedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &bufferedHandler{handler: h.handler.WithAttrs(attrs), buffer: h.buffer}
+}
+
+func (h *bufferedHandler) WithGroup(name string) slog.Handler {
+	return &bufferedHandler{handler: h.handler.WithGroup(name), buffer: h.buffer}
+}
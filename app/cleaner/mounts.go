@@ -0,0 +1,112 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clusterMounts are the volumes mounted by the pods of the whole cluster, to find the dev PVCs whose storage is used from
+// other namespaces through a different claim, such as a ReadWriteMany volume shared with static PVs
+type clusterMounts struct {
+	// byPV are the pods mounting each PV, as namespace/name
+	byPV map[string][]string
+
+	// bySource are the pods mounting each CSI volume or NFS export, as namespace/name
+	bySource map[string][]string
+
+	// pvs are the PVs of the cluster
+	pvs pvIndex
+}
+
+// getClusterMounts lists the pods of all the namespaces whose phase is in phases, and the PVCs and PVs they use, in pages of pageSize items
+func getClusterMounts(ctx context.Context, clientset kubernetes.Interface, phases map[corev1.PodPhase]bool, pageSize int64) (clusterMounts, error) {
+	mounts := clusterMounts{
+		byPV:     make(map[string][]string),
+		bySource: make(map[string][]string),
+	}
+
+	// The pods of each claim, indexed by namespace/claim
+	claimPods := make(map[string][]string)
+	opts := metav1.ListOptions{Limit: pageSize}
+	for {
+		pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return mounts, CheckForbidden(err, "list", "", "pods")
+		}
+		for _, pod := range pods.Items {
+			if !phases[pod.Status.Phase] {
+				continue
+			}
+			for _, claimName := range getPodPVCs(pod) {
+				key := fmt.Sprintf("%s/%s", pod.Namespace, claimName)
+				claimPods[key] = append(claimPods[key], fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+			}
+		}
+		if pods.Continue == "" {
+			break
+		}
+		opts.Continue = pods.Continue
+	}
+	if len(claimPods) == 0 {
+		return mounts, nil
+	}
+
+	opts = metav1.ListOptions{Limit: pageSize}
+	for {
+		pvcs, err := clientset.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, opts)
+		if err != nil {
+			return mounts, CheckForbidden(err, "list", "", "persistentvolumeclaims")
+		}
+		for _, pvc := range pvcs.Items {
+			if pods, ok := claimPods[fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name)]; ok && pvc.Spec.VolumeName != "" {
+				mounts.byPV[pvc.Spec.VolumeName] = append(mounts.byPV[pvc.Spec.VolumeName], pods...)
+			}
+		}
+		if pvcs.Continue == "" {
+			break
+		}
+		opts.Continue = pvcs.Continue
+	}
+
+	index, err := getPVIndex(ctx, clientset, pageSize)
+	if err != nil {
+		return mounts, err
+	}
+	for pvName, pods := range mounts.byPV {
+		if source := pvSource(index.byName[pvName]); source != "" {
+			mounts.bySource[source] = append(mounts.bySource[source], pods...)
+		}
+	}
+	mounts.pvs = index
+
+	return mounts, nil
+}
+
+// podsUsing returns the pods, as namespace/name, mounting the PV bound to the given PVC or the storage backing it
+func (m clusterMounts) podsUsing(pvc corev1.PersistentVolumeClaim) []string {
+	if pvc.Spec.VolumeName == "" {
+		return nil
+	}
+
+	pods := m.byPV[pvc.Spec.VolumeName]
+	if pv, ok := m.pvs.byName[pvc.Spec.VolumeName]; ok {
+		if source := pvSource(pv); source != "" {
+			pods = append(append([]string{}, pods...), m.bySource[source]...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, pod := range pods {
+		if !seen[pod] {
+			seen[pod] = true
+			unique = append(unique, pod)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,672 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Labels Okteto sets on the resources it creates
+const (
+	// stackNameLabel is set on the resources of okteto compose stacks to the name of the stack
+	stackNameLabel = "stack.okteto.com/name"
+
+	// deployedByLabel is set on the resources created by okteto deploy to the name of the dev environment
+	deployedByLabel = "dev.okteto.com/deployed-by"
+)
+
+// deleteRetryInitialInterval is the wait before the first retry of a failed deletion. It doubles on every retry
+const deleteRetryInitialInterval = 500 * time.Millisecond
+
+// deleteRetryJitter is the maximum fraction of the wait randomly added to each retry of a failed deletion,
+// so the deletions that failed at the same time are not retried at the same time
+const deleteRetryJitter = 0.5
+
+// Values of PVCOutcome.Action, also logged in the "action" attribute of each dev PVC
+const (
+	ActionDelete      = "delete"
+	ActionWouldDelete = "would-delete"
+	ActionSkip        = "skip"
+	ActionGone        = "already-gone"
+	ActionError       = "error"
+)
+
+// processNamespace deletes the dev PVCs of the given namespace that are not mounted in any pod.
+// Deletions are throttled by limiter to protect the API server and stop once budget is exhausted.
+// The deletions run on ctx, while the confirmation prompts stop as soon as runCtx, the context of the whole run, is done
+func processNamespace(ctx, runCtx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, opts *Options, limiter *rate.Limiter, budget *Budget, grace graceTracker, cluster clusterScan, namespace string, logger *slog.Logger) NamespaceReport {
+	result := NamespaceReport{Name: namespace}
+	logger.Info(fmt.Sprintf("Checking namespace '%s'", namespace))
+
+	// We retrieve all the PersistentVolumeClaims mounted in pods in the namespace
+	mountedPVCs, pods, err := getMountedPVCs(ctx, clientset, namespace, opts.MountedPodPhases, opts.PageSize, logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Skipping ns %q because there was an error checking PVCs for namespace: %s", namespace, err))
+		result.addError(err)
+		if isListForbidden(err) {
+			result.listForbidden = err
+		}
+		return result
+	}
+	result.PodsScanned = pods
+	for _, mountingPods := range mountedPVCs {
+		result.PVCReferences += len(mountingPods)
+	}
+	logger.Info(fmt.Sprintf("Scanned %d pods in namespace %q, with %d references to %d PVCs", result.PodsScanned, namespace, result.PVCReferences, len(mountedPVCs)))
+
+	// We retrieve all the PersistentVolumeClaims created by Okteto for development containers in the namespace
+	devPVCs, err := getOktetoDevPVCs(ctx, clientset, namespace, opts.DevPVCLabelSelector, opts.PageSize)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Skipping ns %q because there was an error checking dev PVCs for namespace: %s", namespace, err))
+		result.addError(err)
+		if isListForbidden(err) {
+			result.listForbidden = err
+		}
+		return result
+	}
+
+	if opts.GracePeriod > 0 {
+		grace.observe(namespace, devPVCs)
+	}
+
+	if len(devPVCs) == 0 {
+		logger.Info(fmt.Sprintf("Skipping ns %q because there are no dev PVCs", namespace))
+	}
+
+	attachedPVs, mounts, pvs := cluster.attachedPVs, cluster.mounts, cluster.pvs
+
+	var deletions NamespaceReport
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(opts.Concurrency)
+
+	// With buffered logs, the lines of each deletion are written together once all of them finish, in the order they were decided
+	var buffers []*logBuffer
+
+	// For each dev PVC, we delete it if it is not mounted in any pod
+	for _, devPVC := range devPVCs {
+		pvcLogger := logger.With("namespace", namespace, "pvc", devPVC.Name)
+		pvcLogger.Debug("Considering PVC", "created", devPVC.CreationTimestamp.Time, "labels", devPVC.Labels)
+		if opts.ApplyPlan != nil && !opts.ApplyPlan.includes(devPVC) {
+			pvcLogger.Debug("Skipping PVC because it is not in the plan", "action", ActionSkip)
+			result.addSkipped(devPVC, ReasonNotPlanned, "it is not in the plan")
+			continue
+		}
+
+		// The PVCs of the plan are checked again, so the ones mounted since the plan was written are not deleted
+		if pods, ok := mountedPVCs[devPVC.Name]; ok {
+			noun := "pod"
+			if len(pods) > 1 {
+				noun = "pods"
+			}
+			pvcLogger.Info(fmt.Sprintf("Skipping PVC %q because it is mounted by %s %s", devPVC.Name, noun, strings.Join(quoteAll(pods), ", ")), "action", ActionSkip, "pods", pods)
+			result.addSkipped(devPVC, ReasonMounted, fmt.Sprintf("it is mounted by %s %s", noun, strings.Join(quoteAll(pods), ", ")))
+
+			// A PVC mounted again starts a new grace period the next time it is seen unmounted
+			if opts.GracePeriod > 0 && !opts.DryRun {
+				if cleared, err := grace.clearUnmounted(ctx, devPVC); err != nil {
+					pvcLogger.Warn("Error clearing the start of the grace period", "error", err)
+				} else if cleared {
+					pvcLogger.Debug("Cleared the start of the grace period because the PVC is mounted again")
+				}
+			}
+			continue
+		}
+
+		if pods := mounts.podsUsing(devPVC); len(pods) > 0 {
+			pvcLogger.Info(fmt.Sprintf("Skipping PVC %q because its volume is mounted by %s", devPVC.Name, strings.Join(quoteAll(pods), ", ")), "action", ActionSkip, "pv", devPVC.Spec.VolumeName, "pods", pods)
+			result.addSkipped(devPVC, ReasonMounted, fmt.Sprintf("its volume is mounted by %s", strings.Join(quoteAll(pods), ", ")))
+			continue
+		}
+
+		if node, ok := attachedPVs[devPVC.Spec.VolumeName]; ok && devPVC.Spec.VolumeName != "" {
+			pvcLogger.Info(fmt.Sprintf("Skipping PVC %q because its volume is still attached to node %q", devPVC.Name, node), "action", ActionSkip, "pv", devPVC.Spec.VolumeName, "node", node)
+			result.addSkipped(devPVC, ReasonAttached, fmt.Sprintf("its volume is attached to node %q", node))
+			continue
+		}
+
+		if isMarkedToKeep(devPVC, opts.KeepAnnotation) {
+			pvcLogger.Info("Skipping PVC because it is marked to keep", "action", ActionSkip, "annotation", opts.KeepAnnotation)
+			result.addSkipped(devPVC, ReasonKeep, fmt.Sprintf("it is marked to keep with the %s annotation", opts.KeepAnnotation))
+			continue
+		}
+
+		if opts.ProtectSelector != nil && opts.ProtectSelector.Matches(labels.Set(devPVC.Labels)) {
+			pvcLogger.Info("Skipping PVC because its labels match the protect selector", "action", ActionSkip, "selector", opts.ProtectSelector.String())
+			result.addSkipped(devPVC, ReasonProtected, fmt.Sprintf("its labels match the protect selector %q", opts.ProtectSelector.String()))
+			continue
+		}
+
+		if owner := getOwner(devPVC); owner != nil && !opts.DeleteOwned {
+			pvcLogger.Info("Skipping PVC because it is owned by another resource", "action", ActionSkip, "owner", fmt.Sprintf("%s/%s", owner.Kind, owner.Name))
+			result.addSkipped(devPVC, ReasonOwned, fmt.Sprintf("it is owned by %s/%s", owner.Kind, owner.Name))
+			continue
+		}
+
+		if storageClass := pvcStorageClass(devPVC); opts.StorageClass != "" && storageClass != opts.StorageClass {
+			pvcLogger.Info("Skipping PVC because its storage class does not match", "action", ActionSkip, "storageClass", storageClass, "expected", opts.StorageClass)
+			result.addSkipped(devPVC, ReasonStorageClass, fmt.Sprintf("its storage class %q is not %q", storageClass, opts.StorageClass))
+			continue
+		}
+
+		// PVCs without a storage class are never in the allowlist, as the class that provisioned them is unknown
+		if storageClass := pvcStorageClass(devPVC); len(opts.AllowedStorageClasses) > 0 {
+			if !opts.AllowedStorageClasses[storageClass] {
+				pvcLogger.Info("Skipping PVC because its storage class is not allowed", "action", ActionSkip, "storageClass", storageClass)
+				result.addSkipped(devPVC, ReasonStorageClass, fmt.Sprintf("its storage class %q is not allowed", storageClass))
+				continue
+			}
+			pvcLogger.Debug("The storage class of the PVC is allowed", "storageClass", storageClass)
+		}
+
+		if opts.PVCNameRegex != nil && !opts.PVCNameRegex.MatchString(devPVC.Name) {
+			pvcLogger.Info("Skipping PVC because its name does not match", "action", ActionSkip, "regex", opts.PVCNameRegex.String())
+			result.addSkipped(devPVC, ReasonName, fmt.Sprintf("its name does not match %q", opts.PVCNameRegex.String()))
+			continue
+		}
+
+		if volumeType := pvcVolumeType(devPVC); len(opts.VolumeTypes) > 0 && !opts.VolumeTypes[volumeType] {
+			pvcLogger.Info("Skipping PVC because its volume type is not selected", "action", ActionSkip, "volumeType", volumeType)
+			result.addSkipped(devPVC, ReasonVolumeType, fmt.Sprintf("its volume type %q is not selected", volumeType))
+			continue
+		}
+
+		if size := pvcRequestedStorage(devPVC); !opts.MinSize.IsZero() && size.Cmp(opts.MinSize) < 0 {
+			pvcLogger.Info("Skipping PVC because it is smaller than the minimum size", "action", ActionSkip, "size", size.String(), "minSize", opts.MinSize.String())
+			result.addSkipped(devPVC, ReasonTooSmall, fmt.Sprintf("it requests %s, less than the minimum size of %s", size.String(), opts.MinSize.String()))
+			continue
+		}
+
+		if opts.CheckSharedPVs {
+			if reason := pvs.sharedReason(devPVC); reason != "" {
+				pvcLogger.Warn("Skipping PVC because its volume may be shared", "action", ActionSkip, "pv", devPVC.Spec.VolumeName, "reason", reason)
+				result.addSkipped(devPVC, ReasonSharedPV, reason)
+				continue
+			}
+		}
+
+		minAge := opts.MinAge
+		if ttl, ok, err := pvcTTL(devPVC, opts.TTLAnnotation); err != nil {
+			pvcLogger.Warn("Ignoring the invalid TTL of the PVC", "annotation", opts.TTLAnnotation, "error", err)
+		} else if ok {
+			minAge = ttl
+		}
+
+		if age := time.Since(devPVC.CreationTimestamp.Time); age < minAge {
+			pvcLogger.Info("Skipping PVC because it is too recent", "action", ActionSkip, "age", age.Round(time.Second).String(), "minAge", minAge.String())
+			result.addSkipped(devPVC, ReasonTooRecent, fmt.Sprintf("it was created %s ago, more recently than %s", age.Round(time.Second), minAge))
+			continue
+		}
+
+		// Without a recent backup the volume could not be restored, so a missing or invalid annotation keeps the PVC
+		if opts.RequireBackupWithin > 0 {
+			last, ok, err := pvcLastBackup(devPVC, opts.BackupAnnotation)
+			switch {
+			case err != nil:
+				pvcLogger.Warn("Skipping PVC because its last backup time is not valid", "action", ActionSkip, "annotation", opts.BackupAnnotation, "error", err)
+				result.addSkipped(devPVC, ReasonNoBackup, fmt.Sprintf("its last backup time is not valid: %s", err))
+				continue
+			case !ok:
+				pvcLogger.Warn("Skipping PVC because it has never been backed up", "action", ActionSkip, "annotation", opts.BackupAnnotation)
+				result.addSkipped(devPVC, ReasonNoBackup, "it has never been backed up")
+				continue
+			case time.Since(last) > opts.RequireBackupWithin:
+				pvcLogger.Warn("Skipping PVC because it has not been backed up recently", "action", ActionSkip, "lastBackup", last.Format(time.RFC3339), "requireBackupWithin", opts.RequireBackupWithin.String())
+				result.addSkipped(devPVC, ReasonNoBackup, fmt.Sprintf("it was last backed up at %s, more than %s ago", last.Format(time.RFC3339), opts.RequireBackupWithin))
+				continue
+			}
+		}
+
+		// The grace period starts the first time the PVC is seen unmounted, so it spans several runs
+		if opts.GracePeriod > 0 {
+			since, ok := grace.unmountedSince(devPVC)
+			if !ok && opts.DryRun {
+				pvcLogger.Info("Skipping PVC because its grace period would start now", "action", ActionSkip, "gracePeriod", opts.GracePeriod.String())
+				result.addSkipped(devPVC, ReasonGracePeriod, "its grace period would start now")
+				continue
+			}
+
+			if !ok {
+				var started bool
+				var err error
+				since, started, err = grace.markUnmounted(ctx, devPVC)
+				if err != nil {
+					pvcLogger.Error("Error recording the start of the grace period", "action", ActionError, "error", err)
+					result.addError(fmt.Errorf("error recording the start of the grace period of PVC %q: %w", devPVC.Name, err))
+					result.addSkipped(devPVC, ReasonGracePeriod, fmt.Sprintf("the start of its grace period could not be recorded: %s", err))
+					continue
+				}
+				if started {
+					pvcLogger.Debug("Started the grace period of the PVC")
+				}
+			}
+
+			if unmounted := time.Since(since); unmounted < opts.GracePeriod {
+				pvcLogger.Info("Skipping PVC because it is in its grace period", "action", ActionSkip, "unmounted", unmounted.Round(time.Second).String(), "gracePeriod", opts.GracePeriod.String())
+				result.addSkipped(devPVC, ReasonGracePeriod, fmt.Sprintf("it has been unmounted for %s, less than the grace period of %s", unmounted.Round(time.Second), opts.GracePeriod))
+				continue
+			}
+		}
+
+		if !budget.take() {
+			logger.Warn(fmt.Sprintf("The maximum number of deletions (%d) was reached, no more PVCs will be deleted", budget.max))
+			break
+		}
+
+		size := pvcRequestedStorage(devPVC)
+		if opts.DryRun {
+			pvcLogger.Info("Would delete PVC", "action", ActionWouldDelete, "size", size.String())
+			result.addDeleted(devPVC, size)
+			continue
+		}
+
+		if opts.Interactive && !opts.AssumeYes && !confirmDeletion(runCtx, namespace, devPVC.Name, size.String()) {
+			pvcLogger.Info("Skipping PVC because the deletion was not confirmed", "action", ActionSkip)
+			result.addSkipped(devPVC, ReasonNotConfirmed, "the deletion was not confirmed")
+			budget.release()
+			continue
+		}
+
+		// The decisions are taken in order, but up to opts.Concurrency deletions run at the same time.
+		// The goroutines record their outcome in deletions holding mu, and it is merged into result once they finish
+		deletionLogger := pvcLogger
+		if opts.LogBuffered {
+			buffer := &logBuffer{}
+			buffers = append(buffers, buffer)
+			deletionLogger = buffer.logger(pvcLogger)
+		}
+		g.Go(func() error {
+			deleteDevPVC(ctx, clientset, dynamicClient, opts, limiter, budget, devPVC, size, &deletions, &mu, deletionLogger)
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+	for _, buffer := range buffers {
+		buffer.flush(ctx)
+	}
+	result.merge(deletions)
+	return result
+}
+
+// deleteDevPVC deletes the given dev PVC, waiting for the deletion rate limiter, and records the outcome in result holding mu
+func deleteDevPVC(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, opts *Options, limiter *rate.Limiter, budget *Budget, devPVC corev1.PersistentVolumeClaim, size resource.Quantity, result *NamespaceReport, mu *sync.Mutex, logger *slog.Logger) {
+	if err := limiter.Wait(ctx); err != nil {
+		logger.Error("Error waiting for the deletion rate limiter", "action", ActionError, "error", err)
+		mu.Lock()
+		result.addDeleteError(devPVC, err)
+		mu.Unlock()
+		budget.release()
+		return
+	}
+
+	if opts.ReclaimLock {
+		owner, err := acquireReclaimLock(ctx, clientset, devPVC, opts.InstanceID, opts.ReclaimLockTTL)
+		if err != nil {
+			logger.Error("Error claiming the PVC before deleting it", "action", ActionError, "error", err)
+			mu.Lock()
+			result.addDeleteError(devPVC, fmt.Errorf("error claiming the PVC: %w", err))
+			mu.Unlock()
+			budget.release()
+			return
+		}
+		if owner != "" {
+			logger.Info("Skipping PVC because another instance is deleting it", "action", ActionSkip, "owner", owner)
+			mu.Lock()
+			result.addSkipped(devPVC, ReasonLocked, fmt.Sprintf("it is being deleted by %s", owner))
+			mu.Unlock()
+			budget.release()
+			return
+		}
+	}
+
+	if opts.SnapshotBeforeDelete {
+		// The PVC is only deleted once its snapshot can be used to restore it
+		name, err := createSnapshot(ctx, dynamicClient, devPVC, opts.SnapshotClass)
+		if err == nil {
+			logger.Info("Created a snapshot of the PVC", "snapshot", name)
+			err = waitForSnapshot(ctx, dynamicClient, devPVC.Namespace, name, opts.SnapshotTimeout)
+		}
+		if err != nil {
+			logger.Error("Skipping PVC because its snapshot is not ready", "action", ActionError, "error", err)
+			mu.Lock()
+			result.addDeleteError(devPVC, fmt.Errorf("snapshot not ready: %w", err))
+			mu.Unlock()
+			budget.release()
+			return
+		}
+	}
+
+	err := deletePVC(ctx, clientset, devPVC.Namespace, devPVC.Name, metav1.DeleteOptions{PropagationPolicy: opts.DeletePropagation}, opts.MaxRetries)
+	if apierrors.IsNotFound(err) {
+		// Okteto or another tool may delete the PVC after it was listed, which is not a failure of the run
+		logger.Info("Skipping PVC because it was already gone", "action", ActionGone)
+		mu.Lock()
+		result.addGone(devPVC)
+		mu.Unlock()
+		budget.release()
+		return
+	}
+	if err != nil {
+		logger.Error("Error deleting PVC", "action", ActionError, "error", err)
+		mu.Lock()
+		result.addDeleteError(devPVC, err)
+		mu.Unlock()
+		budget.release()
+		return
+	}
+
+	logger.Info("Deleted PVC", "action", ActionDelete, "size", size.String())
+	mu.Lock()
+	result.addDeleted(devPVC, size)
+	mu.Unlock()
+
+	if opts.WaitForDeletion {
+		if err := waitForPVCDeletion(ctx, clientset, devPVC.Namespace, devPVC.Name, opts.DeleteTimeout); err != nil {
+			logger.Warn("PVC is still being deleted", "error", err, "finalizers", devPVC.Finalizers)
+			if !opts.Force || !forceDeletion(ctx, clientset, opts, devPVC, logger) {
+				mu.Lock()
+				result.addStuck(devPVC)
+				mu.Unlock()
+			}
+		}
+	}
+
+	if opts.RecordEvents {
+		if err := recordDeletionEvent(ctx, clientset, devPVC); err != nil {
+			logger.Warn("Error recording the deletion event", "error", err)
+		}
+	}
+}
+
+// isSystemNamespace returns true if the given namespace is one of SystemNamespaces
+func isSystemNamespace(namespace string) bool {
+	for _, system := range strings.Split(SystemNamespaces, ",") {
+		if namespace == system {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortNamespaces sorts nsList in the given order, so that runs are reproducible. The least recently updated
+// namespaces go first when sorting by last update, and names break the ties
+func sortNamespaces(nsList []model.Namespace, order string) {
+	switch order {
+	case SortByName:
+		sort.SliceStable(nsList, func(i, j int) bool {
+			return nsList[i].Name < nsList[j].Name
+		})
+	case SortByLastUpdated:
+		sort.SliceStable(nsList, func(i, j int) bool {
+			if !nsList[i].LastUpdated.Equal(nsList[j].LastUpdated) {
+				return nsList[i].LastUpdated.Before(nsList[j].LastUpdated)
+			}
+			return nsList[i].Name < nsList[j].Name
+		})
+	}
+}
+
+// NewDeleteLimiter returns a rate limiter allowing qps deletions per second. A zero qps disables the limit
+func NewDeleteLimiter(qps float64) *rate.Limiter {
+	if qps <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+
+	return rate.NewLimiter(rate.Limit(qps), 1)
+}
+
+// isNamespaceTerminating returns true if the given namespace is being deleted
+func isNamespaceTerminating(ns *corev1.Namespace) bool {
+	return ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating
+}
+
+// deletePVC deletes the PersistentVolumeClaim with the given name in the given namespace using opts.
+// Retriable API errors are retried up to maxRetries times with exponential backoff. A PVC that is already gone returns a NotFound error
+func deletePVC(ctx context.Context, clientset kubernetes.Interface, namespace, pvcName string, opts metav1.DeleteOptions, maxRetries int) error {
+	backoff := wait.Backoff{
+		Duration: deleteRetryInitialInterval,
+		Factor:   2,
+		Jitter:   deleteRetryJitter,
+		Steps:    maxRetries + 1,
+	}
+
+	err := retry.OnError(backoff, isRetriableError, func() error {
+		return clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, opts)
+	})
+	return CheckForbidden(err, "delete", "", "persistentvolumeclaims")
+}
+
+// forceDeletion removes the finalizers blocking the deletion of the given PVC and waits again for it to be gone.
+// It returns false if the PVC is still present afterwards
+func forceDeletion(ctx context.Context, clientset kubernetes.Interface, opts *Options, pvc corev1.PersistentVolumeClaim, logger *slog.Logger) bool {
+	removed, err := removeFinalizers(ctx, clientset, pvc, opts.DevPVCLabelSelector, opts.ForceFinalizers)
+	if err != nil {
+		logger.Error("Error removing the finalizers of the PVC", "action", ActionError, "error", err)
+		return false
+	}
+	if len(removed) == 0 {
+		logger.Warn("PVC is not blocked by any finalizer that can be removed")
+		return false
+	}
+
+	logger.Warn(fmt.Sprintf("FORCED the removal of the finalizers %s of PVC %q in namespace %q", strings.Join(removed, ", "), pvc.Name, pvc.Namespace), "finalizers", removed)
+	if err := waitForPVCDeletion(ctx, clientset, pvc.Namespace, pvc.Name, opts.DeleteTimeout); err != nil {
+		logger.Warn("PVC is still being deleted after removing its finalizers", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// waitForPVCDeletion polls the PersistentVolumeClaim with the given name in the given namespace until it is gone.
+// It returns an error if the PVC still exists after timeout, usually because a finalizer is blocking its deletion
+func waitForPVCDeletion(ctx context.Context, clientset kubernetes.Interface, namespace, pvcName string, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+
+		// Other errors are retried until the timeout, the PVC may be gone by the next poll
+		return false, nil
+	})
+}
+
+// isRetriableError returns true if the given Kubernetes API error is transient and the request can be retried
+func isRetriableError(err error) bool {
+	return apierrors.IsConflict(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err)
+}
+
+// getOktetoDevPVCs returns the PersistentVolumeClaims matching labelSelector in the given namespace.
+// The PVCs are listed in pages of pageSize items to limit the load on the API server
+func getOktetoDevPVCs(ctx context.Context, clientset kubernetes.Interface, namespace, labelSelector string, pageSize int64) ([]corev1.PersistentVolumeClaim, error) {
+	opts := metav1.ListOptions{
+		LabelSelector: labelSelector,
+		Limit:         pageSize,
+	}
+
+	var devPVCs []corev1.PersistentVolumeClaim
+	for {
+		pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, CheckForbidden(err, "list", "", "persistentvolumeclaims")
+		}
+		devPVCs = append(devPVCs, pvcs.Items...)
+
+		if pvcs.Continue == "" {
+			return devPVCs, nil
+		}
+		opts.Continue = pvcs.Continue
+	}
+}
+
+// pvcRequestedStorage returns the storage requested by the given PersistentVolumeClaim
+func pvcRequestedStorage(pvc corev1.PersistentVolumeClaim) resource.Quantity {
+	return pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+}
+
+// pvcStorageClass returns the storage class of the given PersistentVolumeClaim, or an empty string if it has none
+func pvcStorageClass(pvc corev1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName == nil {
+		return ""
+	}
+
+	return *pvc.Spec.StorageClassName
+}
+
+// pvcVolumeType returns the type of the given dev PersistentVolumeClaim based on the labels Okteto sets on it:
+// VolumeTypeCompose for the volumes of okteto compose stacks, VolumeTypeDeployed for the ones created by
+// okteto deploy, and VolumeTypeDev for the rest, that are the volumes of the dev containers created by okteto up
+func pvcVolumeType(pvc corev1.PersistentVolumeClaim) string {
+	if _, ok := pvc.Labels[stackNameLabel]; ok {
+		return VolumeTypeCompose
+	}
+	if _, ok := pvc.Labels[deployedByLabel]; ok {
+		return VolumeTypeDeployed
+	}
+
+	return VolumeTypeDev
+}
+
+// isMarkedToKeep returns true if the given PersistentVolumeClaim has the keep annotation set to true
+func isMarkedToKeep(pvc corev1.PersistentVolumeClaim, keepAnnotation string) bool {
+	keep, err := strconv.ParseBool(pvc.Annotations[keepAnnotation])
+	return err == nil && keep
+}
+
+// pvcTTL returns the duration set in the TTL annotation of the given PersistentVolumeClaim.
+// It returns false if the annotation is not set, and an error if it is not a valid non-negative duration
+func pvcTTL(pvc corev1.PersistentVolumeClaim, ttlAnnotation string) (time.Duration, bool, error) {
+	value, ok := pvc.Annotations[ttlAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false, err
+	}
+	if ttl < 0 {
+		return 0, false, fmt.Errorf("negative duration %q", value)
+	}
+
+	return ttl, true, nil
+}
+
+// pvcLastBackup returns the time recorded in the backup annotation of the given PersistentVolumeClaim.
+// It returns false if the annotation is not set, and an error if it is not a valid RFC 3339 time
+func pvcLastBackup(pvc corev1.PersistentVolumeClaim, backupAnnotation string) (time.Time, bool, error) {
+	value, ok := pvc.Annotations[backupAnnotation]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	last, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return last, true, nil
+}
+
+// getOwner returns the controller of the given PersistentVolumeClaim, or the StatefulSet it belongs to. It returns nil if the PVC is not owned
+func getOwner(pvc corev1.PersistentVolumeClaim) *metav1.OwnerReference {
+	if controller := metav1.GetControllerOf(&pvc); controller != nil {
+		return controller
+	}
+
+	for i := range pvc.OwnerReferences {
+		if pvc.OwnerReferences[i].Kind == "StatefulSet" {
+			return &pvc.OwnerReferences[i]
+		}
+	}
+
+	return nil
+}
+
+// getMountedPVCs returns the names of the PersistentVolumeClaims mounted in pods in the given namespace whose phase is in phases,
+// mapped to the names of the pods mounting them, and the number of pods scanned.
+// The pods are listed in pages of pageSize items, so only one page is kept in memory at a time
+func getMountedPVCs(ctx context.Context, clientset kubernetes.Interface, namespace string, phases map[corev1.PodPhase]bool, pageSize int64, logger *slog.Logger) (map[string][]string, int, error) {
+	opts := metav1.ListOptions{
+		Limit: pageSize,
+	}
+
+	mountedPVCs := make(map[string][]string)
+	scanned := 0
+	for {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, 0, CheckForbidden(err, "list", "", "pods")
+		}
+
+		scanned += len(pods.Items)
+		for _, pod := range pods.Items {
+			logger.Debug("Scanning pod", "namespace", namespace, "pod", pod.Name, "phase", pod.Status.Phase)
+			if !phases[pod.Status.Phase] {
+				continue
+			}
+			for _, claimName := range getPodPVCs(pod) {
+				logger.Debug("Pod mounts PVC", "namespace", namespace, "pod", pod.Name, "pvc", claimName)
+				mountedPVCs[claimName] = append(mountedPVCs[claimName], pod.Name)
+			}
+		}
+
+		if pods.Continue == "" {
+			return mountedPVCs, scanned, nil
+		}
+		opts.Continue = pods.Continue
+	}
+}
+
+// quoteAll returns the given values quoted with %q
+func quoteAll(values []string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+
+	return quoted
+}
+
+// getPodPVCs returns the names of the PersistentVolumeClaims referenced by the volumes of the given pod.
+// Generic ephemeral volumes are backed by a PVC named after the pod and the volume, so they are included too.
+// Projected volumes can only contain secrets, config maps, downward API and service account tokens, so they never reference a PVC
+func getPodPVCs(pod corev1.Pod) []string {
+	var claimNames []string
+	for _, volume := range pod.Spec.Volumes {
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			claimNames = append(claimNames, volume.PersistentVolumeClaim.ClaimName)
+		case volume.Ephemeral != nil:
+			claimNames = append(claimNames, fmt.Sprintf("%s-%s", pod.Name, volume.Name))
+		}
+	}
+
+	return claimNames
+}
@@ -0,0 +1,61 @@
+package cleaner
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPodPVCs(t *testing.T) {
+	pod := newTestPod("api-7d9f", "data")
+	pod.Spec.Volumes = append(pod.Spec.Volumes,
+		corev1.Volume{
+			Name: "scratch",
+			VolumeSource: corev1.VolumeSource{
+				Ephemeral: &corev1.EphemeralVolumeSource{VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{}},
+			},
+		},
+		corev1.Volume{
+			Name:         "config",
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}},
+		},
+	)
+
+	got := getPodPVCs(*pod)
+	want := []string{"data", "api-7d9f-scratch"}
+	if !slices.Equal(got, want) {
+		t.Errorf("getPodPVCs returned %v, want %v", got, want)
+	}
+}
+
+func TestGetMountedPVCs(t *testing.T) {
+	pending := newTestPod("api-pending", "pending-data")
+	pending.Status.Phase = corev1.PodPending
+	succeeded := newTestPod("migrate", "job-data")
+	succeeded.Status.Phase = corev1.PodSucceeded
+	clientset := fake.NewSimpleClientset(newTestPod("api", "data"), pending, succeeded)
+
+	phases := map[corev1.PodPhase]bool{corev1.PodRunning: true, corev1.PodPending: true}
+	mounted, scanned, err := getMountedPVCs(context.Background(), clientset, testNamespace, phases, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("getMountedPVCs returned an error: %s", err)
+	}
+
+	if scanned != 3 {
+		t.Errorf("scanned %d pods, want 3", scanned)
+	}
+	if pods := mounted["pending-data"]; !slices.Equal(pods, []string{"api-pending"}) {
+		t.Errorf("the PVC of the Pending pod is mounted by %v, want [api-pending]", pods)
+	}
+	if pods := mounted["data"]; !slices.Equal(pods, []string{"api"}) {
+		t.Errorf("the PVC of the Running pod is mounted by %v, want [api]", pods)
+	}
+	if pods, ok := mounted["job-data"]; ok {
+		t.Errorf("the PVC of the Succeeded pod is mounted by %v, want it unmounted", pods)
+	}
+}
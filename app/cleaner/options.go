@@ -0,0 +1,180 @@
+package cleaner
+
+import (
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SystemNamespaces are the namespaces of Kubernetes and Okteto, that should never be processed
+const SystemNamespaces = "kube-system,kube-public,kube-node-lease,okteto,default"
+
+// Volume types of the dev PVCs, used in VolumeTypes
+const (
+	VolumeTypeDev      = "dev"
+	VolumeTypeCompose  = "compose"
+	VolumeTypeDeployed = "deployed"
+)
+
+// Supported values for SortNamespaces
+const (
+	SortByName        = "name"
+	SortByLastUpdated = "last-updated"
+	SortNone          = "none"
+)
+
+// Options are the settings that control how a Cleaner deletes the unused dev PVCs
+type Options struct {
+	// DryRun reports the PVCs that would be deleted without deleting them
+	DryRun bool
+
+	// DevPVCLabelSelector is the label selector used to find the PVCs created by Okteto for development containers
+	DevPVCLabelSelector string
+
+	// ExcludeNamespaces are never processed, even if they are in the namespaces of the Cleaner
+	ExcludeNamespaces map[string]bool
+
+	// SortNamespaces is the order in which the namespaces are processed
+	SortNamespaces string
+
+	// DeleteInSlept processes the namespaces that Okteto put to sleep
+	DeleteInSlept bool
+
+	// OnlySleptOlderThan, when not zero, restricts the run to the namespaces sleeping for longer than this duration
+	OnlySleptOlderThan time.Duration
+
+	// MountedPodPhases are the phases of the pods whose PVCs are considered in use
+	MountedPodPhases map[corev1.PodPhase]bool
+
+	// ReclaimLock claims each dev PVC with an annotation before deleting it, so concurrent instances do not delete the same PVCs
+	ReclaimLock bool
+
+	// ReclaimLockTTL is the time after which the claim of another instance is considered stale
+	ReclaimLockTTL time.Duration
+
+	// InstanceID identifies this process in the reclaim locks
+	InstanceID string
+
+	// CheckSharedPVs keeps the dev PVCs whose PersistentVolume may be used by other claims
+	CheckSharedPVs bool
+
+	// ScanAllMounts keeps the dev PVCs whose volume is mounted by the pods of other namespaces
+	ScanAllMounts bool
+
+	// CheckVolumeAttachments keeps the dev PVCs whose volume is referenced by a VolumeAttachment
+	CheckVolumeAttachments bool
+
+	// VolumeTypes, when not empty, restricts the deletions to the dev PVCs of these volume types
+	VolumeTypes map[string]bool
+
+	// MinAge protects the dev PVCs created more recently than this duration
+	MinAge time.Duration
+
+	// MinNamespaceAge skips the namespaces created more recently than this duration
+	MinNamespaceAge time.Duration
+
+	// GracePeriod protects the dev PVCs first seen unmounted more recently than this duration. Zero disables it
+	GracePeriod time.Duration
+
+	// StateConfigMap, when set, is the ConfigMap in StateNamespace where the grace periods are tracked instead of
+	// annotating the dev PVCs
+	StateConfigMap string
+	StateNamespace string
+
+	// KeepAnnotation protects the dev PVCs where it is set to "true"
+	KeepAnnotation string
+
+	// TTLAnnotation overrides MinAge for the dev PVCs where it is set to a duration
+	TTLAnnotation string
+
+	// RequireBackupWithin, when set, keeps the dev PVCs not backed up within this duration
+	RequireBackupWithin time.Duration
+
+	// BackupAnnotation is the annotation with the time of the last backup of a dev PVC
+	BackupAnnotation string
+
+	// MinSize keeps the dev PVCs requesting less storage. Zero deletes every size
+	MinSize resource.Quantity
+
+	// ProtectSelector, when set, protects the dev PVCs whose labels match it
+	ProtectSelector labels.Selector
+
+	// DeleteOwned allows deleting dev PVCs owned by a controller, such as a StatefulSet
+	DeleteOwned bool
+
+	// StorageClass, when set, restricts the deletions to the dev PVCs of this storage class
+	StorageClass string
+
+	// AllowedStorageClasses, when not empty, restricts the deletions to the dev PVCs of these storage classes
+	AllowedStorageClasses map[string]bool
+
+	// PVCNameRegex, when set, restricts the deletions to the dev PVCs whose name matches it
+	PVCNameRegex *regexp.Regexp
+
+	// DeleteOrphanPVs deletes the Released PVs left behind by the PVCs deleted in the run
+	DeleteOrphanPVs bool
+
+	// RecordEvents creates a Kubernetes event in the namespace of each deleted PVC
+	RecordEvents bool
+
+	// PageSize is the maximum number of items returned by each List call to the Kubernetes API
+	PageSize int64
+
+	// NamespaceTimeout is the maximum time spent processing a namespace
+	NamespaceTimeout time.Duration
+
+	// NamespaceJitter is the maximum random delay waited before processing each namespace
+	NamespaceJitter time.Duration
+
+	// LogBuffered writes the logs of each concurrent deletion together once they all finish, instead of as they happen
+	LogBuffered bool
+
+	// DeletePropagation is the propagation policy of the PVC deletions. When nil, the default policy of the API server is used
+	DeletePropagation *metav1.DeletionPropagation
+
+	// WaitForDeletion waits for each deleted PVC to be gone before moving on to the next one
+	WaitForDeletion bool
+
+	// DeleteTimeout is the maximum time waited for a deleted PVC to be gone
+	DeleteTimeout time.Duration
+
+	// Force removes the finalizers of the deleted PVCs still present after DeleteTimeout. It implies WaitForDeletion
+	Force bool
+
+	// ForceFinalizers are the finalizers removed in force mode, besides the ones set by Okteto
+	ForceFinalizers map[string]bool
+
+	// SnapshotBeforeDelete creates a VolumeSnapshot of each dev PVC and waits for it to be ready before deleting the PVC
+	SnapshotBeforeDelete bool
+
+	// SnapshotClass is the VolumeSnapshotClass of the snapshots. When empty, the default class of the cluster is used
+	SnapshotClass string
+
+	// SnapshotTimeout is the maximum time waited for a snapshot to be ready. The PVC is kept if it is not ready by then
+	SnapshotTimeout time.Duration
+
+	// MaxRetries is the number of times a failed PVC deletion is retried
+	MaxRetries int
+
+	// Concurrency is the maximum number of PVC deletions running at the same time in a namespace
+	Concurrency int
+
+	// DeleteQPS is the maximum number of PVC deletions per second. Zero disables the limit
+	DeleteQPS float64
+
+	// MaxDeletions is the maximum number of PVCs deleted in a run. Zero means unlimited
+	MaxDeletions int
+
+	// Interactive asks for confirmation on stdin before deleting each PVC
+	Interactive bool
+
+	// AssumeYes confirms every deletion automatically when running in interactive mode
+	AssumeYes bool
+
+	// ApplyPlan is the plan read from applyFile. Only its PVCs are deleted
+	ApplyPlan *Plan
+}
@@ -0,0 +1,96 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// runOutput is the JSON document of the run written with WriteJSONOutput
+type runOutput struct {
+	DryRun     bool              `json:"dryRun"`
+	Namespaces []namespaceOutput `json:"namespaces"`
+	Totals     totalsOutput      `json:"totals"`
+}
+
+// namespaceOutput is the outcome of processing a namespace in the JSON output
+type namespaceOutput struct {
+	Name           string             `json:"name"`
+	OktetoURL      string             `json:"oktetoURL"`
+	Deleted        []string           `json:"deleted"`
+	Skipped        []skippedPVCOutput `json:"skipped"`
+	AlreadyGone    []string           `json:"alreadyGone"`
+	Stuck          []string           `json:"stuck"`
+	Errors         []string           `json:"errors"`
+	ReclaimedBytes int64              `json:"reclaimedBytes"`
+	PodsScanned    int                `json:"podsScanned"`
+	PVCReferences  int                `json:"pvcReferences"`
+	Duration       float64            `json:"durationSeconds"`
+}
+
+// skippedPVCOutput is a dev PVC that was not deleted in the JSON output
+type skippedPVCOutput struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// totalsOutput are the totals of the run in the JSON output
+type totalsOutput struct {
+	Namespaces     int     `json:"namespaces"`
+	Deleted        int     `json:"deleted"`
+	Skipped        int     `json:"skipped"`
+	AlreadyGone    int     `json:"alreadyGone"`
+	Stuck          int     `json:"stuck"`
+	Errors         int     `json:"errors"`
+	ReclaimedBytes int64   `json:"reclaimedBytes"`
+	DeletedPVs     int     `json:"deletedPVs"`
+	PodsScanned    int     `json:"podsScanned"`
+	Duration       float64 `json:"durationSeconds"`
+}
+
+// output returns the JSON output of the run
+func (r *Report) output(dryRun bool) runOutput {
+	out := runOutput{
+		DryRun:     dryRun,
+		Namespaces: make([]namespaceOutput, 0, len(r.Namespaces)),
+		Totals: totalsOutput{
+			Namespaces:     len(r.Namespaces),
+			Deleted:        r.Deleted,
+			Errors:         r.Errors,
+			ReclaimedBytes: r.Reclaimed.Value(),
+			DeletedPVs:     r.DeletedPVs,
+			Duration:       r.Duration.Seconds(),
+		},
+	}
+	for _, result := range r.Namespaces {
+		ns := namespaceOutput{
+			Name:           result.Name,
+			OktetoURL:      result.Instance,
+			Deleted:        append([]string{}, result.Deleted...),
+			Skipped:        make([]skippedPVCOutput, 0, len(result.Skipped)),
+			AlreadyGone:    append([]string{}, result.Gone...),
+			Stuck:          append([]string{}, result.Stuck...),
+			Errors:         append([]string{}, result.Errors...),
+			ReclaimedBytes: result.Reclaimed.Value(),
+			PodsScanned:    result.PodsScanned,
+			PVCReferences:  result.PVCReferences,
+			Duration:       result.Duration.Seconds(),
+		}
+		for _, skipped := range result.Skipped {
+			ns.Skipped = append(ns.Skipped, skippedPVCOutput{Name: skipped.Name, Reason: skipped.Reason})
+		}
+		out.Totals.Skipped += len(result.Skipped)
+		out.Totals.AlreadyGone += len(result.Gone)
+		out.Totals.Stuck += len(result.Stuck)
+		out.Totals.PodsScanned += result.PodsScanned
+		out.Namespaces = append(out.Namespaces, ns)
+	}
+
+	return out
+}
+
+// WriteJSONOutput writes the JSON output of the run to w
+func WriteJSONOutput(w io.Writer, r *Report, dryRun bool) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.output(dryRun))
+}
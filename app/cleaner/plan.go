@@ -0,0 +1,103 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Plan is the list of PVCs targeted for deletion written with --plan and deleted with --apply
+type Plan struct {
+	// CreatedAt is the time the plan was written
+	CreatedAt time.Time `json:"createdAt"`
+
+	// PVCs are the dev PVCs that will be deleted when the plan is applied
+	PVCs []PlannedPVC `json:"pvcs"`
+}
+
+// PlannedPVC is a dev PVC targeted for deletion
+type PlannedPVC struct {
+	OktetoURL string    `json:"oktetoURL"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+	Size      string    `json:"size"`
+}
+
+// NewPlan returns the plan with the PVCs that would be deleted in the given dry run
+func NewPlan(r *Report) *Plan {
+	p := &Plan{
+		CreatedAt: time.Now(),
+		PVCs:      []PlannedPVC{},
+	}
+	for _, result := range r.Namespaces {
+		for _, outcome := range result.Outcomes {
+			if outcome.Action != ActionDelete {
+				continue
+			}
+
+			p.PVCs = append(p.PVCs, PlannedPVC{
+				OktetoURL: result.Instance,
+				Namespace: result.Name,
+				Name:      outcome.Name,
+				UID:       outcome.UID,
+				Size:      outcome.Size.String(),
+			})
+		}
+	}
+
+	return p
+}
+
+// includes returns true if the given PVC is in the plan. PVCs are matched by UID, so a PVC recreated
+// with the same name after the plan was written is not included
+func (p *Plan) includes(pvc corev1.PersistentVolumeClaim) bool {
+	for _, planned := range p.PVCs {
+		if planned.UID == pvc.UID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Namespaces returns the namespaces of the given Okteto instance with PVCs in the plan
+func (p *Plan) Namespaces(oktetoURL string) map[string]bool {
+	namespaces := make(map[string]bool)
+	for _, planned := range p.PVCs {
+		if planned.OktetoURL == oktetoURL {
+			namespaces[planned.Namespace] = true
+		}
+	}
+
+	return namespaces
+}
+
+// WritePlan writes the plan as JSON to path
+func WritePlan(path string, p *Plan) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// ReadPlan reads the plan written with --plan at path
+func ReadPlan(path string) (*Plan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the plan: %w", err)
+	}
+
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+
+	return &p, nil
+}
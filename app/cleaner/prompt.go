@@ -0,0 +1,50 @@
+package cleaner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdinReader reads the answers to the confirmation prompts
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// IsInteractiveTerminal returns true if stdin is a terminal where the user can answer the confirmation prompts
+func IsInteractiveTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirmDeletion asks the user to confirm the deletion of the given PVC and returns true if the answer is yes.
+// It returns false without asking once ctx is done, and stops waiting for the answer if ctx is done meanwhile
+func confirmDeletion(ctx context.Context, namespace, pvcName, size string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Delete PVC %q in namespace %q (%s)? [y/N]: ", pvcName, namespace, size)
+	answers := make(chan string, 1)
+	go func() {
+		answer, err := stdinReader.ReadString('\n')
+		if err != nil {
+			answer = ""
+		}
+		answers <- answer
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return false
+	case answer := <-answers:
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// deleteOrphanPVs deletes the Released PersistentVolumes whose claim is one of the PVCs deleted in this run.
+// PVs are matched by the UID of their claim, so volumes bound to a PVC recreated with the same name are never deleted.
+// In dry-run mode the claims are still bound, so it reports the PVs with a Retain policy that would be left behind instead.
+// The PVs are listed in pages of pageSize items. It returns the number of PVs deleted, or that would be deleted in
+// dry-run mode, and the number of errors
+func deleteOrphanPVs(ctx context.Context, clientset kubernetes.Interface, deletedClaims map[types.UID]bool, dryRun bool, pageSize int64, logger *slog.Logger) (int, int) {
+	opts := metav1.ListOptions{
+		Limit: pageSize,
+	}
+	deleted, errors, notReleased := 0, 0, 0
+	for {
+		pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, opts)
+		if err != nil {
+			err = CheckForbidden(err, "list", "", "persistentvolumes")
+			logger.Error(fmt.Sprintf("There was an error listing the PersistentVolumes: %s", err))
+			return deleted, errors + 1
+		}
+
+		for _, pv := range pvs.Items {
+			if pv.Spec.ClaimRef == nil || !deletedClaims[pv.Spec.ClaimRef.UID] {
+				continue
+			}
+
+			pvLogger := logger.With("pv", pv.Name, "namespace", pv.Spec.ClaimRef.Namespace, "pvc", pv.Spec.ClaimRef.Name)
+			if dryRun {
+				if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimRetain {
+					pvLogger.Info("Would delete PV once its claim is released", "action", ActionWouldDelete)
+					deleted++
+				}
+				continue
+			}
+
+			if pv.Status.Phase != corev1.VolumeReleased {
+				pvLogger.Debug("Skipping PV because it is not released", "phase", pv.Status.Phase)
+				notReleased++
+				continue
+			}
+
+			err := CheckForbidden(clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}), "delete", "", "persistentvolumes")
+			if err != nil && !apierrors.IsNotFound(err) {
+				pvLogger.Error("Error deleting PV", "action", ActionError, "error", err)
+				errors++
+				continue
+			}
+
+			pvLogger.Info("Deleted PV", "action", ActionDelete)
+			deleted++
+		}
+
+		if pvs.Continue == "" {
+			break
+		}
+		opts.Continue = pvs.Continue
+	}
+
+	// Without WAIT_FOR_DELETION the claims may not be gone yet, so their PVs are still bound
+	if notReleased > 0 {
+		logger.Info(fmt.Sprintf("Skipped %d PVs of the deleted PVCs because they are not Released yet. Enable WAIT_FOR_DELETION so the claims are gone before the PVs are checked", notReleased))
+	}
+
+	return deleted, errors
+}
+
+// pvIndex holds the PersistentVolumes of the cluster, to find the ones backing the same storage
+type pvIndex struct {
+	byName map[string]corev1.PersistentVolume
+
+	// bySource are the names of the PVs using each CSI volume or NFS export
+	bySource map[string][]string
+}
+
+// getPVIndex lists the PersistentVolumes of the cluster in pages of pageSize items and indexes them
+func getPVIndex(ctx context.Context, clientset kubernetes.Interface, pageSize int64) (pvIndex, error) {
+	index := pvIndex{
+		byName:   make(map[string]corev1.PersistentVolume),
+		bySource: make(map[string][]string),
+	}
+	opts := metav1.ListOptions{
+		Limit: pageSize,
+	}
+	for {
+		pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, opts)
+		if err != nil {
+			return index, CheckForbidden(err, "list", "", "persistentvolumes")
+		}
+
+		for _, pv := range pvs.Items {
+			index.byName[pv.Name] = pv
+			if source := pvSource(pv); source != "" {
+				index.bySource[source] = append(index.bySource[source], pv.Name)
+			}
+		}
+
+		if pvs.Continue == "" {
+			return index, nil
+		}
+		opts.Continue = pvs.Continue
+	}
+}
+
+// pvSource returns the storage backing the given PV, if it can be shared by several PVs: the handle of its
+// CSI volume or its NFS export. It returns an empty string for the rest
+func pvSource(pv corev1.PersistentVolume) string {
+	switch {
+	case pv.Spec.CSI != nil:
+		return fmt.Sprintf("csi:%s/%s", pv.Spec.CSI.Driver, pv.Spec.CSI.VolumeHandle)
+	case pv.Spec.NFS != nil:
+		return fmt.Sprintf("nfs:%s:%s", pv.Spec.NFS.Server, pv.Spec.NFS.Path)
+	}
+
+	return ""
+}
+
+// sharedReason returns why the PV bound to the given PVC may be used by other claims, or an empty string if it is only used by this PVC.
+// A PV is shared if its claimRef does not point at the PVC, or if another PV is backed by the same storage
+func (i pvIndex) sharedReason(pvc corev1.PersistentVolumeClaim) string {
+	if pvc.Spec.VolumeName == "" {
+		return ""
+	}
+
+	pv, ok := i.byName[pvc.Spec.VolumeName]
+	if !ok {
+		return ""
+	}
+
+	if ref := pv.Spec.ClaimRef; ref == nil || ref.UID != pvc.UID || ref.Namespace != pvc.Namespace || ref.Name != pvc.Name {
+		return fmt.Sprintf("the claimRef of PV %q does not point at the PVC", pv.Name)
+	}
+
+	if source := pvSource(pv); source != "" {
+		for _, other := range i.bySource[source] {
+			if other != pv.Name {
+				return fmt.Sprintf("PV %q is backed by the same storage as PV %q", pv.Name, other)
+			}
+		}
+	}
+
+	return ""
+}
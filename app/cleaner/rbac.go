@@ -0,0 +1,41 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// permissionError is returned when the Kubernetes API rejects a request because the credentials of the job
+// are missing an RBAC permission
+type permissionError struct {
+	verb     string
+	group    string
+	resource string
+	err      error
+}
+
+func (e *permissionError) Error() string {
+	return fmt.Sprintf("missing RBAC permission to %s %s, add the rule {apiGroups: [%q], resources: [%q], verbs: [%q]} to the role of the job: %s", e.verb, e.resource, e.group, e.resource, e.verb, e.err)
+}
+
+func (e *permissionError) Unwrap() error {
+	return e.err
+}
+
+// CheckForbidden returns a permissionError naming the RBAC rule to add if err is a Forbidden error of the
+// given request. Any other error is returned as it is
+func CheckForbidden(err error, verb, group, resource string) error {
+	if !apierrors.IsForbidden(err) {
+		return err
+	}
+
+	return &permissionError{verb: verb, group: group, resource: resource, err: err}
+}
+
+// isListForbidden returns true if err is a permissionError of a list request
+func isListForbidden(err error) bool {
+	var permErr *permissionError
+	return errors.As(err, &permErr) && permErr.verb == "list"
+}
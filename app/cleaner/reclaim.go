@@ -0,0 +1,78 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// reclaimingAnnotation records the instance of the tool that is deleting a dev PVC
+	reclaimingAnnotation = "dev.okteto.com/reclaiming"
+
+	// reclaimingSinceAnnotation records when the instance of reclaimingAnnotation claimed the PVC
+	reclaimingSinceAnnotation = "dev.okteto.com/reclaiming-since"
+)
+
+// DefaultInstanceID returns the identifier of this process in the reclaim locks: the hostname, which is the pod
+// name in Kubernetes, and the process ID
+func DefaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// acquireReclaimLock claims the given PVC for the instance id by annotating it. It returns the instance that holds the lock
+// if it is another one and its claim is more recent than ttl, or an empty string if the lock was acquired.
+// The annotations are patched with the resource version of the PVC, so only one of the instances claiming it at the same time succeeds
+func acquireReclaimLock(ctx context.Context, clientset kubernetes.Interface, pvc corev1.PersistentVolumeClaim, id string, ttl time.Duration) (string, error) {
+	current, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// The deletion reports the PVC as already gone
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if current.UID != pvc.UID {
+		return "", fmt.Errorf("the PVC was recreated")
+	}
+
+	if owner := current.Annotations[reclaimingAnnotation]; owner != "" && owner != id {
+		since, err := time.Parse(time.RFC3339, current.Annotations[reclaimingSinceAnnotation])
+		if err == nil && time.Since(since) < ttl {
+			return owner, nil
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				reclaimingAnnotation:      id,
+				reclaimingSinceAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+			"resourceVersion": current.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(ctx, pvc.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsConflict(err) {
+		return "a concurrent instance", nil
+	}
+
+	return "", CheckForbidden(err, "patch", "", "persistentvolumeclaims")
+}
@@ -0,0 +1,452 @@
+package cleaner
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/metrics"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/notify"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons why a dev PVC is not deleted, recorded in SkippedPVC.Reason and PVCOutcome.Reason
+const (
+	ReasonMounted      = "mounted"
+	ReasonAttached     = "attached"
+	ReasonSharedPV     = "shared-pv"
+	ReasonKeep         = "keep"
+	ReasonProtected    = "protected"
+	ReasonOwned        = "owned"
+	ReasonStorageClass = "storage-class"
+	ReasonName         = "name"
+	ReasonVolumeType   = "volume-type"
+	ReasonTooSmall     = "too-small"
+	ReasonTooRecent    = "too-recent"
+	ReasonGracePeriod  = "grace-period"
+	ReasonNotConfirmed = "not-confirmed"
+	ReasonNotPlanned   = "not-planned"
+	ReasonLocked       = "locked"
+	ReasonNoBackup     = "no-backup"
+)
+
+// SkippedPVC is a dev PVC that was not deleted
+type SkippedPVC struct {
+	Name   string
+	Reason string
+}
+
+// PVCOutcome is the decision taken for a dev PVC
+type PVCOutcome struct {
+	Name   string
+	UID    types.UID
+	Size   resource.Quantity
+	Action string
+
+	// Reason is why the PVC was skipped, or the error found deleting it
+	Reason string
+
+	// Detail is the rationale of the decision logged with --explain
+	Detail string
+
+	Timestamp time.Time
+}
+
+// NamespaceReport is the outcome of processing a namespace
+type NamespaceReport struct {
+	// Name is the name of the namespace
+	Name string
+
+	// Instance is the URL of the Okteto instance of the namespace
+	Instance string
+
+	// Deleted are the PVCs deleted, or that would be deleted in dry-run mode
+	Deleted []string
+
+	// DeletedUIDs are the UIDs of the deleted PVCs
+	DeletedUIDs []types.UID
+
+	// Gone are the dev PVCs that no longer existed when they were going to be deleted
+	Gone []string
+
+	// Stuck are the deleted PVCs that still existed after the deletion timeout
+	Stuck []string
+
+	// Skipped are the dev PVCs that were kept
+	Skipped []SkippedPVC
+
+	// Errors are the errors found listing or deleting PVCs
+	Errors []string
+
+	// DeleteErrors is the number of PVCs that could not be deleted
+	DeleteErrors int
+
+	// Reclaimed is the storage requested by the deleted PVCs
+	Reclaimed resource.Quantity
+
+	// Outcomes are the decisions taken for every dev PVC evaluated, in order
+	Outcomes []PVCOutcome
+
+	// PodsScanned is the number of pods listed in the namespace
+	PodsScanned int
+
+	// PVCReferences is the number of references to PVCs found in the pods that keep them in use
+	PVCReferences int
+
+	// Duration is the time spent processing the namespace
+	Duration time.Duration
+
+	// listForbidden is the permission error returned when listing the pods or the PVCs of the namespace, if any
+	listForbidden error
+}
+
+// addOutcome records the decision taken for the given PVC
+func (r *NamespaceReport) addOutcome(pvc corev1.PersistentVolumeClaim, action, reason, detail string) {
+	r.Outcomes = append(r.Outcomes, PVCOutcome{
+		Name:      pvc.Name,
+		UID:       pvc.UID,
+		Size:      pvcRequestedStorage(pvc),
+		Action:    action,
+		Reason:    reason,
+		Detail:    detail,
+		Timestamp: time.Now(),
+	})
+}
+
+// addDeleted records the deletion of a PVC requesting the given storage
+func (r *NamespaceReport) addDeleted(pvc corev1.PersistentVolumeClaim, size resource.Quantity) {
+	r.Deleted = append(r.Deleted, pvc.Name)
+	r.DeletedUIDs = append(r.DeletedUIDs, pvc.UID)
+	r.Reclaimed.Add(size)
+	r.addOutcome(pvc, ActionDelete, "", "it is not in use and no setting keeps it")
+}
+
+// addGone records a dev PVC that was deleted by someone else after it was listed
+func (r *NamespaceReport) addGone(pvc corev1.PersistentVolumeClaim) {
+	r.Gone = append(r.Gone, pvc.Name)
+	r.addOutcome(pvc, ActionGone, "", "it was deleted by someone else after it was listed")
+}
+
+// addStuck records a deleted PVC that still existed after the deletion timeout
+func (r *NamespaceReport) addStuck(pvc corev1.PersistentVolumeClaim) {
+	r.Stuck = append(r.Stuck, pvc.Name)
+}
+
+// addSkipped records a dev PVC kept for the given reason, described in detail
+func (r *NamespaceReport) addSkipped(pvc corev1.PersistentVolumeClaim, reason, detail string) {
+	r.Skipped = append(r.Skipped, SkippedPVC{Name: pvc.Name, Reason: reason})
+	r.addOutcome(pvc, ActionSkip, reason, detail)
+}
+
+// addError records an error found while processing the namespace
+func (r *NamespaceReport) addError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// addDeleteError records an error deleting the given PVC
+func (r *NamespaceReport) addDeleteError(pvc corev1.PersistentVolumeClaim, err error) {
+	r.addError(fmt.Errorf("error deleting PVC %q: %w", pvc.Name, err))
+	r.DeleteErrors++
+	r.addOutcome(pvc, ActionError, err.Error(), "the deletion failed")
+}
+
+// merge adds the PVCs recorded in other, a partial result of the same namespace, into r
+func (r *NamespaceReport) merge(other NamespaceReport) {
+	r.Deleted = append(r.Deleted, other.Deleted...)
+	r.DeletedUIDs = append(r.DeletedUIDs, other.DeletedUIDs...)
+	r.Gone = append(r.Gone, other.Gone...)
+	r.Stuck = append(r.Stuck, other.Stuck...)
+	r.Skipped = append(r.Skipped, other.Skipped...)
+	r.Errors = append(r.Errors, other.Errors...)
+	r.DeleteErrors += other.DeleteErrors
+	r.Reclaimed.Add(other.Reclaimed)
+	r.Outcomes = append(r.Outcomes, other.Outcomes...)
+	r.PodsScanned += other.PodsScanned
+	r.PVCReferences += other.PVCReferences
+}
+
+// Report is the outcome of a cleanup run across all the namespaces. Run returns it without logging nor sending it,
+// so the summary, the outputs and the notifications are all built from it
+type Report struct {
+	// Namespaces are the results of the namespaces processed
+	Namespaces []NamespaceReport
+
+	// Deleted is the number of PVCs deleted, or that would be deleted in dry-run mode
+	Deleted int
+
+	// Reclaimed is the storage requested by the deleted PVCs
+	Reclaimed resource.Quantity
+
+	// Errors is the number of errors found listing or deleting PVCs and PVs
+	Errors int
+
+	// DeletedPVs is the number of orphan PVs deleted, or that would be deleted in dry-run mode
+	DeletedPVs int
+
+	// Duration is the time spent in the run
+	Duration time.Duration
+}
+
+// add merges the result of a processed namespace into r
+func (r *Report) add(result NamespaceReport) {
+	r.Namespaces = append(r.Namespaces, result)
+	r.Deleted += len(result.Deleted)
+	r.Reclaimed.Add(result.Reclaimed)
+	r.Errors += len(result.Errors)
+}
+
+// Merge adds the results of other, usually the report of another Okteto instance, into r
+func (r *Report) Merge(other Report) {
+	r.Namespaces = append(r.Namespaces, other.Namespaces...)
+	r.Deleted += other.Deleted
+	r.Reclaimed.Add(other.Reclaimed)
+	r.Errors += other.Errors
+	r.DeletedPVs += other.DeletedPVs
+	r.Duration += other.Duration
+}
+
+// deletedClaims returns the UIDs of all the PVCs deleted in the run
+func (r *Report) deletedClaims() map[types.UID]bool {
+	uids := make(map[types.UID]bool)
+	for _, result := range r.Namespaces {
+		for _, uid := range result.DeletedUIDs {
+			uids[uid] = true
+		}
+	}
+
+	return uids
+}
+
+// skippedByReason returns the number of dev PVCs kept for each reason
+func (r *Report) skippedByReason() map[string]int {
+	skipped := make(map[string]int)
+	for _, result := range r.Namespaces {
+		for _, pvc := range result.Skipped {
+			skipped[pvc.Reason]++
+		}
+	}
+
+	return skipped
+}
+
+// Log prints the summary of the run
+func (r *Report) Log(logger *slog.Logger, dryRun, orphanPVs bool) {
+	found, skipped, gone, stuck, deleteErrors, pods := 0, 0, 0, 0, 0, 0
+	for _, result := range r.Namespaces {
+		pods += result.PodsScanned
+		found += len(result.Outcomes)
+		skipped += len(result.Skipped)
+		gone += len(result.Gone)
+		stuck += len(result.Stuck)
+		deleteErrors += result.DeleteErrors
+	}
+
+	byReason := r.skippedByReason()
+	reasons := make([]string, 0, len(byReason))
+	for reason := range byReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	breakdown := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		breakdown = append(breakdown, fmt.Sprintf("%s=%d", reason, byReason[reason]))
+	}
+
+	logger.Info("===============================================")
+	logger.Info("Summary")
+	logger.Info(fmt.Sprintf("Namespaces processed: %d", len(r.Namespaces)))
+	logger.Info(fmt.Sprintf("Pods scanned: %d", pods))
+	logger.Info(fmt.Sprintf("Dev PVCs found: %d", found))
+	logger.Info(fmt.Sprintf("%s: %d", deleteVerb(dryRun), r.Deleted))
+	if len(breakdown) > 0 {
+		logger.Info(fmt.Sprintf("Skipped: %d (%s)", skipped, strings.Join(breakdown, ", ")))
+	} else {
+		logger.Info(fmt.Sprintf("Skipped: %d", skipped))
+	}
+	logger.Info(fmt.Sprintf("Already gone: %d", gone))
+	logger.Info(fmt.Sprintf("Still being deleted: %d", stuck))
+	logger.Info(fmt.Sprintf("Delete errors: %d", deleteErrors))
+	logger.Info(fmt.Sprintf("Errors: %d", r.Errors))
+	if orphanPVs {
+		logger.Info(fmt.Sprintf("%s orphan PVs: %d", deleteVerb(dryRun), r.DeletedPVs))
+	}
+	logger.Info(fmt.Sprintf("%s %s across %d PVCs", reclaimVerb(dryRun), r.Reclaimed.String(), r.Deleted))
+	logger.Info(fmt.Sprintf("Duration: %s", r.Duration.Round(time.Millisecond)))
+	logger.Info("===============================================")
+}
+
+// LogDiff prints a table with the dev PVCs found in each namespace, the ones that would be deleted and the
+// ones that would remain, followed by the totals of the run
+func (r *Report) LogDiff(logger *slog.Logger) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tFOUND\tWOULD DELETE\tWOULD REMAIN")
+	found, deleted := 0, 0
+	for _, result := range r.Namespaces {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", result.Name, len(result.Outcomes), len(result.Deleted), len(result.Outcomes)-len(result.Deleted))
+		found += len(result.Outcomes)
+		deleted += len(result.Deleted)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\n", found, deleted, found-deleted)
+	w.Flush()
+
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		logger.Info(line)
+	}
+}
+
+// LogTop logs a table with the n largest PVCs deleted, or that would be deleted in dry-run mode, by requested storage
+func (r *Report) LogTop(logger *slog.Logger, n int, dryRun bool) {
+	type deletedPVC struct {
+		namespace string
+		outcome   PVCOutcome
+	}
+
+	var deleted []deletedPVC
+	for _, result := range r.Namespaces {
+		for _, outcome := range result.Outcomes {
+			if outcome.Action == ActionDelete {
+				deleted = append(deleted, deletedPVC{namespace: result.Name, outcome: outcome})
+			}
+		}
+	}
+	if len(deleted) == 0 {
+		return
+	}
+
+	sort.SliceStable(deleted, func(i, j int) bool {
+		return deleted[i].outcome.Size.Cmp(deleted[j].outcome.Size) > 0
+	})
+	if len(deleted) > n {
+		deleted = deleted[:n]
+	}
+
+	verb := "deleted"
+	if dryRun {
+		verb = "that would be deleted"
+	}
+	logger.Info(fmt.Sprintf("Largest %d PVCs %s:", len(deleted), verb))
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPVC\tSIZE")
+	for _, pvc := range deleted {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", pvc.namespace, pvc.outcome.Name, pvc.outcome.Size.String())
+	}
+	w.Flush()
+
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		logger.Info(line)
+	}
+}
+
+// LogExplain logs a line with the decision taken for every dev PVC evaluated and its rationale
+func (r *Report) LogExplain(logger *slog.Logger, dryRun bool) {
+	for _, result := range r.Namespaces {
+		for _, outcome := range result.Outcomes {
+			action := outcome.Action
+			if action == ActionDelete && dryRun {
+				action = ActionWouldDelete
+			}
+
+			logger.Info(fmt.Sprintf("Decision for PVC %s/%s: %s because %s", result.Name, outcome.Name, action, outcome.Detail), "namespace", result.Name, "pvc", outcome.Name, "decision", action, "reason", outcome.Reason, "size", outcome.Size.String())
+		}
+	}
+}
+
+// StuckClaims returns the namespace and name of the deleted PVCs that still existed after the deletion timeout
+func (r *Report) StuckClaims() []string {
+	var stuck []string
+	for _, result := range r.Namespaces {
+		for _, name := range result.Stuck {
+			stuck = append(stuck, fmt.Sprintf("%s/%s", result.Name, name))
+		}
+	}
+
+	return stuck
+}
+
+// Notification returns the summary reported in the notifications
+func (r *Report) Notification(dryRun bool) notify.Summary {
+	return notify.Summary{
+		DryRun:     dryRun,
+		Namespaces: len(r.Namespaces),
+		Deleted:    r.Deleted,
+		Errors:     r.Errors,
+		Stuck:      len(r.StuckClaims()),
+		Reclaimed:  r.Reclaimed.String(),
+	}
+}
+
+// WebhookReport returns the detailed report of the run sent to the generic webhook
+func (r *Report) WebhookReport(startTime time.Time, oktetoURL string, dryRun bool) notify.Report {
+	report := notify.Report{
+		Timestamp:  startTime,
+		OktetoURL:  oktetoURL,
+		DryRun:     dryRun,
+		Namespaces: make([]notify.NamespaceReport, 0, len(r.Namespaces)),
+	}
+	for _, result := range r.Namespaces {
+		nsReport := notify.NamespaceReport{
+			Name:      result.Name,
+			OktetoURL: result.Instance,
+			Deleted:   append([]string{}, result.Deleted...),
+			Stuck:     append([]string{}, result.Stuck...),
+			Skipped:   make([]notify.SkippedPVC, 0, len(result.Skipped)),
+			Errors:    append([]string{}, result.Errors...),
+		}
+		for _, skipped := range result.Skipped {
+			nsReport.Skipped = append(nsReport.Skipped, notify.SkippedPVC{Name: skipped.Name, Reason: skipped.Reason})
+		}
+		report.Namespaces = append(report.Namespaces, nsReport)
+	}
+
+	return report
+}
+
+// Metrics returns the per-namespace metrics of the run
+func (r *Report) Metrics() []metrics.Namespace {
+	namespaces := make([]metrics.Namespace, 0, len(r.Namespaces))
+	for _, result := range r.Namespaces {
+		ns := metrics.Namespace{
+			Name:           result.Name,
+			OktetoURL:      result.Instance,
+			Deleted:        len(result.Deleted),
+			Skipped:        make(map[string]int),
+			DeleteErrors:   result.DeleteErrors,
+			ReclaimedBytes: result.Reclaimed.Value(),
+			Duration:       result.Duration,
+		}
+		for _, skipped := range result.Skipped {
+			ns.Skipped[skipped.Reason]++
+		}
+		namespaces = append(namespaces, ns)
+	}
+
+	return namespaces
+}
+
+// reclaimVerb returns the verb used to report the reclaimed storage
+func reclaimVerb(dryRun bool) string {
+	if dryRun {
+		return "Would reclaim"
+	}
+
+	return "Reclaimed"
+}
+
+// deleteVerb returns the verb used to report the deleted resources
+func deleteVerb(dryRun bool) string {
+	if dryRun {
+		return "Would delete"
+	}
+
+	return "Deleted"
+}
@@ -0,0 +1,85 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+// volumeSnapshotGVR is the resource of the VolumeSnapshots of the CSI external snapshotter
+var volumeSnapshotGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+
+// snapshotSourceAnnotation records in each VolumeSnapshot the name of the dev PVC it was taken from
+const snapshotSourceAnnotation = "dev.okteto.com/snapshot-of"
+
+// createSnapshot creates a VolumeSnapshot of the given PVC with the given VolumeSnapshotClass and returns its name.
+// An empty snapshotClass uses the default class of the cluster
+func createSnapshot(ctx context.Context, client dynamic.Interface, pvc corev1.PersistentVolumeClaim, snapshotClass string) (string, error) {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvc.Name,
+		},
+	}
+	if snapshotClass != "" {
+		spec["volumeSnapshotClassName"] = snapshotClass
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"generateName": fmt.Sprintf("%s-", pvc.Name),
+			"namespace":    pvc.Namespace,
+			"labels": map[string]interface{}{
+				"app.kubernetes.io/managed-by": eventSourceComponent,
+			},
+			"annotations": map[string]interface{}{
+				snapshotSourceAnnotation: pvc.Name,
+			},
+		},
+		"spec": spec,
+	}}
+
+	created, err := client.Resource(volumeSnapshotGVR).Namespace(pvc.Namespace).Create(ctx, snapshot, metav1.CreateOptions{})
+	if err != nil {
+		return "", CheckForbidden(err, "create", volumeSnapshotGVR.Group, volumeSnapshotGVR.Resource)
+	}
+
+	return created.GetName(), nil
+}
+
+// waitForSnapshot polls the VolumeSnapshot with the given name until it is ready to use.
+// It returns an error if the snapshot failed or is not ready after timeout
+func waitForSnapshot(ctx context.Context, client dynamic.Interface, namespace, name string, timeout time.Duration) error {
+	var snapshotErr error
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		snapshot, err := client.Resource(volumeSnapshotGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			// Errors are retried until the timeout, the API server may be temporarily unavailable
+			return false, nil
+		}
+
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found && message != "" {
+			snapshotErr = fmt.Errorf("snapshot %q failed: %s", name, message)
+			return false, snapshotErr
+		}
+
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		return ready, nil
+	})
+	if snapshotErr != nil {
+		return snapshotErr
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot %q is not ready after %s: %w", name, timeout, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// stateKey is the key of the ConfigMap data with the state of the grace periods
+const stateKey = "unmounted-since.json"
+
+// stateEntry records the first time a dev PVC was seen unmounted
+type stateEntry struct {
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	UnmountedSince time.Time `json:"unmountedSince"`
+}
+
+// configMapState tracks the grace periods in a ConfigMap instead of annotating every dev PVC.
+// The entries are indexed by the UID of the PVC, so a PVC recreated with the same name starts a new grace period
+type configMapState struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	entries   map[types.UID]stateEntry
+
+	// The changes of this run, applied again on top of the latest state if the ConfigMap is updated concurrently
+	marked   map[types.UID]stateEntry
+	cleared  map[types.UID]bool
+	observed map[string]map[types.UID]bool
+}
+
+// loadConfigMapState reads the state of the grace periods from the given ConfigMap. A missing ConfigMap is an empty state
+func loadConfigMapState(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (*configMapState, error) {
+	s := &configMapState{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		marked:    make(map[types.UID]stateEntry),
+		cleared:   make(map[types.UID]bool),
+		observed:  make(map[string]map[types.UID]bool),
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		s.entries = make(map[types.UID]stateEntry)
+		return s, nil
+	}
+	if err != nil {
+		return nil, CheckForbidden(err, "get", "", "configmaps")
+	}
+
+	s.entries, err = decodeState(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// decodeState returns the entries stored in the given ConfigMap
+func decodeState(cm *corev1.ConfigMap) (map[types.UID]stateEntry, error) {
+	entries := make(map[types.UID]stateEntry)
+	if value, ok := cm.Data[stateKey]; ok {
+		if err := json.Unmarshal([]byte(value), &entries); err != nil {
+			return nil, fmt.Errorf("invalid state in ConfigMap %s/%s: %w", cm.Namespace, cm.Name, err)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *configMapState) unmountedSince(pvc corev1.PersistentVolumeClaim) (time.Time, bool) {
+	entry, ok := s.entries[pvc.UID]
+	return entry.UnmountedSince, ok
+}
+
+func (s *configMapState) markUnmounted(_ context.Context, pvc corev1.PersistentVolumeClaim) (time.Time, bool, error) {
+	if since, ok := s.unmountedSince(pvc); ok {
+		return since, false, nil
+	}
+
+	entry := stateEntry{Namespace: pvc.Namespace, Name: pvc.Name, UnmountedSince: time.Now().UTC().Truncate(time.Second)}
+	s.entries[pvc.UID] = entry
+	s.marked[pvc.UID] = entry
+	delete(s.cleared, pvc.UID)
+	return entry.UnmountedSince, true, nil
+}
+
+func (s *configMapState) clearUnmounted(_ context.Context, pvc corev1.PersistentVolumeClaim) (bool, error) {
+	if _, ok := s.entries[pvc.UID]; !ok {
+		return false, nil
+	}
+
+	delete(s.entries, pvc.UID)
+	delete(s.marked, pvc.UID)
+	s.cleared[pvc.UID] = true
+	return true, nil
+}
+
+// observe records the dev PVCs listed in the given namespace, so the entries of the PVCs that no longer exist are removed
+func (s *configMapState) observe(namespace string, pvcs []corev1.PersistentVolumeClaim) {
+	uids := make(map[types.UID]bool, len(pvcs))
+	for _, pvc := range pvcs {
+		uids[pvc.UID] = true
+	}
+	s.observed[namespace] = uids
+}
+
+// save writes the changes of this run to the ConfigMap, creating it if needed. If the ConfigMap was updated
+// by another run in the meantime, the changes are applied again on top of its latest state
+func (s *configMapState) save(ctx context.Context) error {
+	configMaps := s.clientset.CoreV1().ConfigMaps(s.namespace)
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return CheckForbidden(err, "get", "", "configmaps")
+		}
+		if create {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+		}
+
+		entries, err := decodeState(cm)
+		if err != nil {
+			return err
+		}
+		s.apply(entries)
+
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[stateKey] = string(data)
+
+		// The update is rejected with a conflict if the resourceVersion read above is no longer the latest
+		if create {
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return CheckForbidden(err, "create", "", "configmaps")
+		}
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return CheckForbidden(err, "update", "", "configmaps")
+	})
+}
+
+// apply applies the changes of this run to entries
+func (s *configMapState) apply(entries map[types.UID]stateEntry) {
+	for uid, entry := range entries {
+		if uids, ok := s.observed[entry.Namespace]; ok && !uids[uid] {
+			delete(entries, uid)
+		}
+	}
+	for uid := range s.cleared {
+		delete(entries, uid)
+	}
+	for uid, entry := range s.marked {
+		if _, ok := entries[uid]; !ok {
+			entries[uid] = entry
+		}
+	}
+}
@@ -0,0 +1,951 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/okteto-community/delete-unused-dev-volumes/app/api"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/cleaner"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// defaultDevPVCLabelSelector is the label Okteto sets on the PVCs created for development containers
+const defaultDevPVCLabelSelector = "dev.okteto.com=true"
+
+// defaultKeepAnnotation is the annotation developers set to "true" to preserve a dev PVC
+const defaultKeepAnnotation = "dev.okteto.com/keep"
+
+// defaultTTLAnnotation is the annotation developers set to a duration to choose how long a dev PVC is kept
+const defaultTTLAnnotation = "dev.okteto.com/ttl"
+
+// defaultBackupAnnotation is the annotation where the backup system records the time of the last backup of a volume
+const defaultBackupAnnotation = "backup.okteto.com/last"
+
+// defaultMountedPodPhases are the phases of the pods that keep their PVCs in use by default
+const defaultMountedPodPhases = "Running,Pending"
+
+// defaultKubeconfigCommand is the command that writes the kubeconfig of the cluster of an Okteto instance
+const defaultKubeconfigCommand = "okteto kubeconfig"
+
+// Supported values for OUTPUT
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// serviceAccountNamespaceFile has the namespace of the pod the tool runs in
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// defaultNamespaceTimeout is the default maximum time spent processing a namespace without snapshots nor waits for the deletions
+const defaultNamespaceTimeout = 60 * time.Second
+
+// namespaceTimeoutWaits is the number of snapshot and deletion waits added to the default NAMESPACE_TIMEOUT when they are enabled
+const namespaceTimeoutWaits = 5
+
+// confirmDeleteToken is the value of CONFIRM_DELETE required to delete PVCs
+const confirmDeleteToken = "yes-delete-my-volumes"
+
+// Supported values for NAMESPACE_SCOPE
+const (
+	scopePersonal = "personal"
+	scopeShared   = "shared"
+	scopeAll      = "all"
+)
+
+// Supported values for LOG_FORMAT
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// instance is an Okteto instance to clean up
+type instance struct {
+	// url is the URL of the Okteto instance
+	url string
+
+	// token is the admin token used to call the Okteto API
+	token string
+}
+
+// config holds the settings that control a cleanup run
+type config struct {
+	// instances are the Okteto instances cleaned up in the run
+	instances []instance
+
+	// Options are the settings of the Cleaner of each Okteto instance
+	cleaner.Options
+
+	// deleteNotConfirmed is true when the run was switched to dry-run mode because CONFIRM_DELETE is not set
+	deleteNotConfirmed bool
+
+	// namespaces, when set, are processed instead of the namespaces returned by the Okteto API
+	namespaces []string
+
+	// includeNamespaces restricts the run to the given namespaces. When empty, every namespace is processed
+	includeNamespaces map[string]bool
+
+	// namespaceScope restricts the run to the personal namespaces, the shared ones, or all of them
+	namespaceScope string
+
+	// namespaceRegex, when set, restricts the run to the namespaces whose name matches it
+	namespaceRegex *regexp.Regexp
+
+	// namespaceLabelSelector, when set, restricts the run to the namespaces whose Kubernetes labels match it
+	namespaceLabelSelector string
+
+	// runTimeout is the maximum time spent in a run. 0 disables it
+	runTimeout time.Duration
+
+	// schedule, when set, is the cron expression on which the process runs the cleanup instead of running it once
+	schedule string
+
+	// healthPort is the port of the health server. 0 means the default port in scheduler mode, and no server otherwise
+	healthPort int
+
+	// output is the format of the result printed at the end of the run, either outputText or outputJSON
+	output string
+
+	// quiet only logs the warnings, the errors and the summary of the run
+	quiet bool
+
+	// logFormat is the format of the log output, either logFormatText or logFormatJSON
+	logFormat string
+
+	// logLevel is the minimum level of the logged messages
+	logLevel slog.Level
+
+	// httpTimeout is the timeout of each request sent to the Okteto API
+	httpTimeout time.Duration
+
+	// apiMaxRetries is the number of times a failed request to the Okteto API is retried
+	apiMaxRetries int
+
+	// insecureSkipTLSVerify disables the verification of the TLS certificate of the Okteto API
+	insecureSkipTLSVerify bool
+
+	// rootCAs are the certificate authorities trusted to verify the Okteto API, loaded from OKTETO_CA_CERT_FILE
+	rootCAs *x509.CertPool
+
+	// apiHeaders are added to the requests to the Okteto API, parsed from OKTETO_API_HEADERS
+	apiHeaders http.Header
+
+	// inCluster uses the ServiceAccount of the pod to talk to Kubernetes instead of the Okteto CLI
+	inCluster bool
+
+	// kubeconfigCommand is the command run to write the kubeconfig of each Okteto instance
+	kubeconfigCommand string
+
+	// kubeconfigTimeout is the maximum time kubeconfigCommand can take. Zero disables the timeout
+	kubeconfigTimeout time.Duration
+
+	// kubeContext is the context of the kubeconfig used to talk to Kubernetes. When empty, the current context is used
+	kubeContext string
+
+	// kubeServer overrides the URL of the Kubernetes API server of the kubeconfig
+	kubeServer string
+
+	// skipKubeconfig uses the kubeconfig already present in the environment instead of generating one with the Okteto CLI
+	skipKubeconfig bool
+
+	// slackWebhookURL is the Slack incoming webhook notified with the summary of the run
+	slackWebhookURL string
+
+	// webhookURL is the endpoint that receives a detailed JSON report of the run
+	webhookURL string
+
+	// pushgatewayURL is the Prometheus Pushgateway that receives the metrics of the run
+	pushgatewayURL string
+
+	// reportCSV is the path of the CSV file where the decision taken for every dev PVC is written
+	reportCSV string
+
+	// failOnError makes the process exit with a nonzero code if any error was found during the run
+	failOnError bool
+
+	// failOnEmpty makes the process exit with a nonzero code if the Okteto API returns no namespaces
+	failOnEmpty bool
+
+	// planFile is the path where the PVCs that would be deleted are written instead of deleting them
+	planFile string
+
+	// applyFile is the path of a plan written with planFile whose PVCs are deleted
+	applyFile string
+
+	// top is the number of largest deleted PVCs listed at the end of the run
+	top int
+
+	// explain logs the decision taken for every dev PVC and its rationale at the end of the run
+	explain bool
+}
+
+// loadConfig builds the configuration from the config file, the environment and the command line flags.
+// Flags take precedence over environment variables, which take precedence over the config file
+func loadConfig(args []string) (*config, error) {
+	configFile := configFilePath(args)
+	if configFile != "" {
+		if err := applyConfigFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	dryRun, err := getEnvBool("DRY_RUN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	minAge, err := getEnvDuration("MIN_AGE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	minNamespaceAge, err := getEnvDuration("MIN_NAMESPACE_AGE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	requireBackupWithin, err := getEnvDuration("REQUIRE_BACKUP_WITHIN", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	minSize, err := getEnvQuantity("MIN_SIZE")
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries, err := getEnvInt("MAX_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	httpTimeout, err := getEnvDuration("HTTP_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	apiMaxRetries, err := getEnvInt("API_MAX_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	inCluster, err := getEnvBool("IN_CLUSTER", false)
+	if err != nil {
+		return nil, err
+	}
+
+	skipKubeconfig, err := getEnvBool("SKIP_KUBECONFIG", false)
+	if err != nil {
+		return nil, err
+	}
+
+	failOnError, err := getEnvBool("FAIL_ON_ERROR", true)
+	if err != nil {
+		return nil, err
+	}
+
+	failOnEmpty, err := getEnvBool("FAIL_ON_EMPTY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteOwned, err := getEnvBool("DELETE_OWNED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	checkVolumeAttachments, err := getEnvBool("CHECK_VOLUME_ATTACHMENTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	checkSharedPVs, err := getEnvBool("CHECK_SHARED_PVS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	scanAllMounts, err := getEnvBool("SCAN_ALL_NAMESPACES_FOR_MOUNTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	reclaimLock, err := getEnvBool("RECLAIM_LOCK", false)
+	if err != nil {
+		return nil, err
+	}
+
+	reclaimLockTTL, err := getEnvDuration("RECLAIM_LOCK_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteOrphanPVs, err := getEnvBool("DELETE_ORPHAN_PVS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	healthPort, err := getEnvInt("HEALTH_PORT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if healthPort < 0 || healthPort > 65535 {
+		return nil, fmt.Errorf("invalid value %d for HEALTH_PORT: must be a valid TCP port", healthPort)
+	}
+
+	pageSize, err := getEnvInt("PAGE_SIZE", 500)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteQPS, err := getEnvFloat("DELETE_QPS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDeletions, err := getEnvInt("MAX_DELETIONS", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteInSlept, err := getEnvBool("DELETE_IN_SLEPT", false)
+	if err != nil {
+		return nil, err
+	}
+
+	recordEvents, err := getEnvBool("RECORD_EVENTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// When NAMESPACE_TIMEOUT is not set, its default is increased below to leave room for the enabled waits
+	namespaceTimeoutSet := os.Getenv("NAMESPACE_TIMEOUT") != ""
+	namespaceTimeout, err := getEnvDuration("NAMESPACE_TIMEOUT", defaultNamespaceTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceJitter, err := getEnvDuration("NAMESPACE_JITTER", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	runTimeout, err := getEnvDuration("RUN_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeconfigTimeout, err := getEnvDuration("KUBECONFIG_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	gracePeriod, err := getEnvDuration("GRACE_PERIOD", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	waitForDeletion, err := getEnvBool("WAIT_FOR_DELETION", false)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteTimeout, err := getEnvDuration("DELETE_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	force, err := getEnvBool("FORCE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	forceFinalizers := getEnvList("FORCE_FINALIZERS")
+
+	excludeSystemNamespaces, err := getEnvBool("EXCLUDE_SYSTEM_NAMESPACES", true)
+	if err != nil {
+		return nil, err
+	}
+	excludeNamespaces := getEnvList("EXCLUDE_NAMESPACES")
+	if excludeSystemNamespaces {
+		excludeNamespaces = append(excludeNamespaces, splitList(cleaner.SystemNamespaces)...)
+	}
+
+	insecureSkipTLSVerify, err := getEnvBool("OKTETO_INSECURE_SKIP_TLS_VERIFY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency, err := getEnvInt("CONCURRENCY", 1)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("invalid value %d for CONCURRENCY: must be at least 1", concurrency)
+	}
+
+	logBuffered, err := getEnvBool("LOG_BUFFERED", false)
+	if err != nil {
+		return nil, err
+	}
+
+	quiet, err := getEnvBool("LOG_QUIET", false)
+	if err != nil {
+		return nil, err
+	}
+
+	onlySleptOlderThan, err := getEnvDuration("ONLY_SLEPT_OLDER_THAN", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotBeforeDelete, err := getEnvBool("SNAPSHOT_BEFORE_DELETE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotTimeout, err := getEnvDuration("SNAPSHOT_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{
+		Options: cleaner.Options{
+			DevPVCLabelSelector:    getEnv("DEV_PVC_LABEL_SELECTOR", defaultDevPVCLabelSelector),
+			ExcludeNamespaces:      toSet(excludeNamespaces),
+			DeleteInSlept:          deleteInSlept,
+			OnlySleptOlderThan:     onlySleptOlderThan,
+			MinAge:                 minAge,
+			MinNamespaceAge:        minNamespaceAge,
+			GracePeriod:            gracePeriod,
+			StateConfigMap:         getEnv("STATE_CONFIGMAP", ""),
+			StateNamespace:         getEnv("STATE_CONFIGMAP_NAMESPACE", ""),
+			KeepAnnotation:         getEnv("KEEP_ANNOTATION", defaultKeepAnnotation),
+			TTLAnnotation:          getEnv("TTL_ANNOTATION", defaultTTLAnnotation),
+			RequireBackupWithin:    requireBackupWithin,
+			BackupAnnotation:       getEnv("BACKUP_ANNOTATION", defaultBackupAnnotation),
+			MinSize:                minSize,
+			DeleteOwned:            deleteOwned,
+			CheckVolumeAttachments: checkVolumeAttachments,
+			CheckSharedPVs:         checkSharedPVs,
+			ScanAllMounts:          scanAllMounts,
+			ReclaimLock:            reclaimLock,
+			ReclaimLockTTL:         reclaimLockTTL,
+			InstanceID:             getEnv("INSTANCE_ID", cleaner.DefaultInstanceID()),
+			StorageClass:           os.Getenv("STORAGE_CLASS"),
+			AllowedStorageClasses:  toSet(getEnvList("ALLOWED_STORAGE_CLASSES")),
+			VolumeTypes:            toSet(getEnvList("VOLUME_TYPES")),
+			LogBuffered:            logBuffered,
+			WaitForDeletion:        waitForDeletion || force,
+			Force:                  force,
+			ForceFinalizers:        toSet(forceFinalizers),
+			DeleteTimeout:          deleteTimeout,
+			SnapshotBeforeDelete:   snapshotBeforeDelete,
+			SnapshotClass:          os.Getenv("SNAPSHOT_CLASS"),
+			SnapshotTimeout:        snapshotTimeout,
+			MaxRetries:             maxRetries,
+			Concurrency:            concurrency,
+			DeleteQPS:              deleteQPS,
+			MaxDeletions:           maxDeletions,
+			RecordEvents:           recordEvents,
+			PageSize:               int64(pageSize),
+			NamespaceTimeout:       namespaceTimeout,
+			NamespaceJitter:        namespaceJitter,
+		},
+		includeNamespaces:      toSet(getEnvList("INCLUDE_NAMESPACES")),
+		namespaceLabelSelector: os.Getenv("NAMESPACE_LABEL_SELECTOR"),
+		logFormat:              getEnv("LOG_FORMAT", logFormatText),
+		output:                 getEnv("OUTPUT", outputText),
+		schedule:               os.Getenv("SCHEDULE"),
+		namespaceScope:         getEnv("NAMESPACE_SCOPE", scopeAll),
+		healthPort:             healthPort,
+		slackWebhookURL:        os.Getenv("SLACK_WEBHOOK_URL"),
+		webhookURL:             os.Getenv("WEBHOOK_URL"),
+		pushgatewayURL:         os.Getenv("PUSHGATEWAY_URL"),
+		reportCSV:              os.Getenv("REPORT_CSV"),
+		httpTimeout:            httpTimeout,
+		apiMaxRetries:          apiMaxRetries,
+		insecureSkipTLSVerify:  insecureSkipTLSVerify,
+		inCluster:              inCluster,
+		skipKubeconfig:         skipKubeconfig,
+		kubeconfigCommand:      getEnv("KUBECONFIG_COMMAND", defaultKubeconfigCommand),
+		kubeContext:            os.Getenv("KUBE_CONTEXT"),
+		kubeServer:             os.Getenv("KUBE_SERVER"),
+		kubeconfigTimeout:      kubeconfigTimeout,
+		failOnError:            failOnError,
+		failOnEmpty:            failOnEmpty,
+		runTimeout:             runTimeout,
+	}
+
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := cfg.logLevel.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid value %q for LOG_LEVEL: %w", value, err)
+		}
+	}
+
+	if cfg.inCluster && (cfg.kubeContext != "" || cfg.kubeServer != "") {
+		return nil, fmt.Errorf("KUBE_CONTEXT and KUBE_SERVER cannot be used with IN_CLUSTER")
+	}
+
+	for volumeType := range cfg.VolumeTypes {
+		if volumeType != cleaner.VolumeTypeDev && volumeType != cleaner.VolumeTypeCompose && volumeType != cleaner.VolumeTypeDeployed {
+			return nil, fmt.Errorf("invalid value %q for VOLUME_TYPES: must be a list of %q, %q or %q", volumeType, cleaner.VolumeTypeDev, cleaner.VolumeTypeCompose, cleaner.VolumeTypeDeployed)
+		}
+	}
+
+	if value := os.Getenv("OKTETO_API_HEADERS"); value != "" {
+		cfg.apiHeaders, err = api.ParseHeaders(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for OKTETO_API_HEADERS: %w", err)
+		}
+	}
+
+	if path := os.Getenv("OKTETO_CA_CERT_FILE"); path != "" {
+		cfg.rootCAs, err = api.LoadCertPool(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading OKTETO_CA_CERT_FILE: %w", err)
+		}
+	}
+
+	if strings.TrimSpace(cfg.kubeconfigCommand) == "" {
+		return nil, fmt.Errorf("KUBECONFIG_COMMAND cannot be blank")
+	}
+
+	if cfg.namespaceScope != scopePersonal && cfg.namespaceScope != scopeShared && cfg.namespaceScope != scopeAll {
+		return nil, fmt.Errorf("invalid value %q for NAMESPACE_SCOPE: must be %q, %q or %q", cfg.namespaceScope, scopePersonal, scopeShared, scopeAll)
+	}
+
+	if cfg.StorageClass != "" && len(cfg.AllowedStorageClasses) > 0 {
+		return nil, fmt.Errorf("STORAGE_CLASS and ALLOWED_STORAGE_CLASSES cannot be used together")
+	}
+
+	if cfg.schedule != "" {
+		if _, err := cron.ParseStandard(cfg.schedule); err != nil {
+			return nil, fmt.Errorf("invalid value %q for SCHEDULE: %w", cfg.schedule, err)
+		}
+	}
+
+	// A deletion waits for the snapshot and then for the PVC to be gone within the timeout of its namespace. The waits of
+	// the PVCs deleted one after the other add up, so the default leaves room for several of them, while an explicit
+	// NAMESPACE_TIMEOUT is only rejected if not even one deletion can complete within it
+	var waits time.Duration
+	var names []string
+	if cfg.SnapshotBeforeDelete {
+		waits += cfg.SnapshotTimeout
+		names = append(names, fmt.Sprintf("SNAPSHOT_TIMEOUT (%s)", cfg.SnapshotTimeout))
+	}
+	if cfg.WaitForDeletion {
+		waits += cfg.DeleteTimeout
+		names = append(names, fmt.Sprintf("DELETE_TIMEOUT (%s)", cfg.DeleteTimeout))
+	}
+	switch {
+	case !namespaceTimeoutSet:
+		cfg.NamespaceTimeout += namespaceTimeoutWaits * waits
+	case cfg.NamespaceTimeout > 0 && waits >= cfg.NamespaceTimeout:
+		return nil, fmt.Errorf("%s must fit in NAMESPACE_TIMEOUT (%s): raise NAMESPACE_TIMEOUT, unset it or set it to 0", strings.Join(names, " plus "), cfg.NamespaceTimeout)
+	}
+
+	if cfg.StateConfigMap != "" {
+		if cfg.GracePeriod == 0 {
+			return nil, fmt.Errorf("STATE_CONFIGMAP can only be used with GRACE_PERIOD")
+		}
+		if cfg.StateNamespace == "" {
+			// The ConfigMap is kept in the namespace of the pod of the job by default
+			namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+			if err != nil {
+				return nil, fmt.Errorf("STATE_CONFIGMAP_NAMESPACE must be set when not running in a pod: %w", err)
+			}
+			cfg.StateNamespace = strings.TrimSpace(string(namespace))
+		}
+	}
+
+	if cfg.output != outputText && cfg.output != outputJSON {
+		return nil, fmt.Errorf("invalid value %q for OUTPUT: must be %q or %q", cfg.output, outputText, outputJSON)
+	}
+
+	if cfg.logFormat != logFormatText && cfg.logFormat != logFormatJSON {
+		return nil, fmt.Errorf("invalid value %q for LOG_FORMAT: must be %q or %q", cfg.logFormat, logFormatText, logFormatJSON)
+	}
+
+	if value := os.Getenv("DELETE_PROPAGATION"); value != "" {
+		policy := metav1.DeletionPropagation(value)
+		switch policy {
+		case metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan:
+			cfg.DeletePropagation = &policy
+		default:
+			return nil, fmt.Errorf("invalid value %q for DELETE_PROPAGATION: must be %q, %q or %q", value, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan)
+		}
+	}
+
+	cfg.MountedPodPhases, err = getPodPhases("MOUNTED_POD_PHASES", defaultMountedPodPhases)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := os.Getenv("NAMESPACE_REGEX"); value != "" {
+		cfg.namespaceRegex, err = regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for NAMESPACE_REGEX: %w", value, err)
+		}
+	}
+
+	if value := os.Getenv("PVC_NAME_REGEX"); value != "" {
+		cfg.PVCNameRegex, err = regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for PVC_NAME_REGEX: %w", value, err)
+		}
+	}
+
+	if cfg.namespaceLabelSelector != "" {
+		if _, err := labels.Parse(cfg.namespaceLabelSelector); err != nil {
+			return nil, fmt.Errorf("invalid value %q for NAMESPACE_LABEL_SELECTOR: %w", cfg.namespaceLabelSelector, err)
+		}
+	}
+
+	if value := os.Getenv("PROTECT_LABEL_SELECTOR"); value != "" {
+		cfg.ProtectSelector, err = labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for PROTECT_LABEL_SELECTOR: %w", value, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("delete-unused-dev-volumes", flag.ContinueOnError)
+	fs.Bool("version", false, "print the version and exit")
+	fs.String("config", configFile, "path of a YAML file with the settings of the run (env CONFIG_FILE)")
+	fs.BoolVar(&cfg.DryRun, "dry-run", dryRun, "report the PVCs that would be deleted without deleting them (env DRY_RUN)")
+	fs.BoolVar(&cfg.DeleteOrphanPVs, "delete-orphan-pvs", deleteOrphanPVs, "delete the Released PVs left behind by the deleted PVCs (env DELETE_ORPHAN_PVS)")
+	fs.BoolVar(&cfg.quiet, "quiet", quiet, "only log the warnings, the errors and the summary of the run (env LOG_QUIET)")
+	fs.BoolVar(&cfg.Interactive, "interactive", false, "ask for confirmation before deleting each PVC")
+	fs.BoolVar(&cfg.AssumeYes, "yes", false, "confirm every deletion automatically in interactive mode")
+	fs.BoolVar(&cfg.AssumeYes, "y", false, "shorthand for --yes")
+	fs.StringVar(&cfg.SortNamespaces, "sort", getEnv("SORT", cleaner.SortByName), fmt.Sprintf("order in which the namespaces are processed: %q, %q or %q (env SORT)", cleaner.SortByName, cleaner.SortByLastUpdated, cleaner.SortNone))
+	fs.StringVar(&cfg.planFile, "plan", "", "write the PVCs that would be deleted to this JSON file instead of deleting them")
+	fs.StringVar(&cfg.applyFile, "apply", "", "delete the PVCs of the plan written with --plan to this JSON file")
+	fs.BoolVar(&cfg.explain, "explain", false, "log the decision taken for every dev PVC and its rationale at the end of the run")
+	fs.IntVar(&cfg.top, "top", 0, "list the given number of largest PVCs deleted, or that would be deleted, at the end of the run")
+	namespaces := fs.String("namespaces", "", "comma-separated list of namespaces to process instead of the ones returned by the Okteto API")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.namespaces = splitList(*namespaces)
+
+	// The Okteto API is not called when the namespaces are set explicitly, so the credentials are only needed to generate the kubeconfig
+	requireCredentials := len(cfg.namespaces) == 0 || (!cfg.inCluster && !cfg.skipKubeconfig)
+	cfg.instances, err = getInstances(requireCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.instances) > 1 && (cfg.inCluster || cfg.skipKubeconfig) {
+		return nil, fmt.Errorf("IN_CLUSTER and SKIP_KUBECONFIG can only be used with a single Okteto instance")
+	}
+
+	if len(cfg.instances) > 1 && len(cfg.namespaces) > 0 {
+		return nil, fmt.Errorf("--namespaces can only be used with a single Okteto instance")
+	}
+
+	// The sleep state of a namespace is only known through the Okteto API, so with --namespaces a sleeping
+	// namespace would look unused and lose all its dev PVCs
+	if len(cfg.namespaces) > 0 && !cfg.DeleteInSlept {
+		return nil, fmt.Errorf("--namespaces can only be used with DELETE_IN_SLEPT=true, since the Okteto API is not called to skip the sleeping namespaces")
+	}
+
+	if len(cfg.namespaces) > 0 && cfg.OnlySleptOlderThan > 0 {
+		return nil, fmt.Errorf("--namespaces cannot be used with ONLY_SLEPT_OLDER_THAN, since the Okteto API is not called to know when the namespaces went to sleep")
+	}
+
+	if cfg.SortNamespaces != cleaner.SortByName && cfg.SortNamespaces != cleaner.SortByLastUpdated && cfg.SortNamespaces != cleaner.SortNone {
+		return nil, fmt.Errorf("invalid value %q for --sort: must be %q, %q or %q", cfg.SortNamespaces, cleaner.SortByName, cleaner.SortByLastUpdated, cleaner.SortNone)
+	}
+
+	if cfg.Interactive && cfg.schedule != "" {
+		return nil, fmt.Errorf("--interactive cannot be used with SCHEDULE")
+	}
+
+	if cfg.top < 0 {
+		return nil, fmt.Errorf("invalid value %d for --top: must be positive", cfg.top)
+	}
+
+	if cfg.planFile != "" && cfg.applyFile != "" {
+		return nil, fmt.Errorf("--plan and --apply cannot be used together")
+	}
+
+	if cfg.planFile != "" {
+		cfg.DryRun = true
+	}
+
+	// Deleting PVCs must be acknowledged explicitly, so a job configured by accident only reports what it would delete
+	if !cfg.DryRun && os.Getenv("CONFIRM_DELETE") != confirmDeleteToken {
+		cfg.DryRun = true
+		cfg.deleteNotConfirmed = true
+	}
+
+	if cfg.applyFile != "" {
+		cfg.ApplyPlan, err = cleaner.ReadPlan(cfg.applyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// getOktetoToken returns the Okteto token from the file referenced by OKTETO_TOKEN_FILE or, if it is not set, from OKTETO_TOKEN
+func getOktetoToken() (string, error) {
+	path := os.Getenv("OKTETO_TOKEN_FILE")
+	if path == "" {
+		return os.Getenv("OKTETO_TOKEN"), nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading OKTETO_TOKEN_FILE: %w", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// normalizeOktetoURL returns the given Okteto URL with the https scheme if it has none, e.g. for "okteto.example.com".
+// It returns an error if the URL has no host or a scheme other than http or https
+func normalizeOktetoURL(raw string) (string, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q for OKTETO_URL: %w", raw, err)
+	}
+	// The Okteto API is always called over HTTPS, so the token is never sent in the clear
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("invalid value %q for OKTETO_URL: the scheme must be https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid value %q for OKTETO_URL: it has no host, set it to the URL of the Okteto instance, e.g. https://okteto.example.com", raw)
+	}
+
+	return raw, nil
+}
+
+// getInstances returns the Okteto instances defined by the comma-separated, index-aligned lists of OKTETO_URL and OKTETO_TOKEN (or OKTETO_TOKEN_FILE).
+// The URL and token in OKTETO_CREDENTIALS_FILE are used when the corresponding environment variables are not set.
+// If requireCredentials is false and none is set, it returns a single instance without URL nor token
+func getInstances(requireCredentials bool) ([]instance, error) {
+	token, err := getOktetoToken()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := getEnvList("OKTETO_URL")
+	tokens := splitList(token)
+
+	if path := os.Getenv("OKTETO_CREDENTIALS_FILE"); path != "" {
+		creds, err := readCredentialsFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(urls) == 0 {
+			urls = splitList(creds.URL)
+		}
+		if len(tokens) == 0 {
+			tokens = splitList(creds.Token)
+		}
+	}
+
+	if !requireCredentials && len(urls) == 0 && len(tokens) == 0 {
+		return []instance{{}}, nil
+	}
+
+	if len(urls) == 0 || len(tokens) == 0 {
+		return nil, fmt.Errorf("OKTETO_TOKEN (or OKTETO_TOKEN_FILE) and OKTETO_URL environment variables, or OKTETO_CREDENTIALS_FILE, are required")
+	}
+	if len(urls) != len(tokens) {
+		return nil, fmt.Errorf("OKTETO_URL has %d values but OKTETO_TOKEN has %d, they must have one token per URL", len(urls), len(tokens))
+	}
+
+	instances := make([]instance, 0, len(urls))
+	for i := range urls {
+		oktetoURL, err := normalizeOktetoURL(urls[i])
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance{url: oktetoURL, token: tokens[i]})
+	}
+
+	return instances, nil
+}
+
+// apiOptions returns the options of the requests sent to the Okteto API
+func (c *config) apiOptions() api.Options {
+	return api.Options{
+		Timeout:            c.httpTimeout,
+		MaxRetries:         c.apiMaxRetries,
+		InsecureSkipVerify: c.insecureSkipTLSVerify,
+		RootCAs:            c.rootCAs,
+		Headers:            c.apiHeaders,
+	}
+}
+
+// instanceURLs returns the comma-separated list of the URLs of the Okteto instances
+func (c *config) instanceURLs() string {
+	urls := make([]string, 0, len(c.instances))
+	for _, inst := range c.instances {
+		urls = append(urls, inst.url)
+	}
+
+	return strings.Join(urls, ",")
+}
+
+// getEnv returns the value of the given environment variable, or defaultValue if it is not set
+func getEnv(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// getEnvBool returns the boolean value of the given environment variable, or defaultValue if it is not set
+func getEnvBool(name string, defaultValue bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+
+	return b, nil
+}
+
+// getEnvInt returns the non-negative integer value of the given environment variable, or defaultValue if it is not set
+func getEnvInt(name string, defaultValue int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: must not be negative", value, name)
+	}
+
+	return i, nil
+}
+
+// getEnvFloat returns the non-negative float value of the given environment variable, or defaultValue if it is not set
+func getEnvFloat(name string, defaultValue float64) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	if f < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: must not be negative", value, name)
+	}
+
+	return f, nil
+}
+
+// getEnvDuration returns the duration value of the given environment variable, or defaultValue if it is not set
+func getEnvDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+
+	return d, nil
+}
+
+// getEnvQuantity returns the value of the given environment variable as a resource quantity, e.g. 5Gi, or zero if it is not set
+func getEnvQuantity(name string) (resource.Quantity, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return resource.Quantity{}, nil
+	}
+
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	if q.Sign() < 0 {
+		return resource.Quantity{}, fmt.Errorf("invalid value %q for %s: must not be negative", value, name)
+	}
+
+	return q, nil
+}
+
+// getEnvList returns the comma-separated values of the given environment variable, ignoring empty items
+func getEnvList(name string) []string {
+	return splitList(os.Getenv(name))
+}
+
+// splitList returns the non-empty values of the given comma-separated list
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// getPodPhases returns the pod phases in the comma-separated list of the given environment variable, or in defaultValue if it is not set
+func getPodPhases(name, defaultValue string) (map[corev1.PodPhase]bool, error) {
+	values := getEnvList(name)
+	if len(values) == 0 {
+		values = strings.Split(defaultValue, ",")
+	}
+
+	phases := make(map[corev1.PodPhase]bool, len(values))
+	for _, value := range values {
+		phase := corev1.PodPhase(value)
+		switch phase {
+		case corev1.PodPending, corev1.PodRunning, corev1.PodSucceeded, corev1.PodFailed, corev1.PodUnknown:
+			phases[phase] = true
+		default:
+			return nil, fmt.Errorf("invalid value %q for %s: must be a list of Pending, Running, Succeeded, Failed or Unknown", value, name)
+		}
+	}
+
+	return phases, nil
+}
+
+// toSet returns a map with an entry for each of the given values
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+
+	return set
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigNamespaceTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    time.Duration
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: defaultNamespaceTimeout,
+		},
+		{
+			name: "WAIT_FOR_DELETION with its defaults",
+			env:  map[string]string{"WAIT_FOR_DELETION": "true"},
+			want: defaultNamespaceTimeout + 5*2*time.Minute,
+		},
+		{
+			name: "FORCE with its defaults",
+			env:  map[string]string{"FORCE": "true"},
+			want: defaultNamespaceTimeout + 5*2*time.Minute,
+		},
+		{
+			name: "SNAPSHOT_BEFORE_DELETE with its defaults",
+			env:  map[string]string{"SNAPSHOT_BEFORE_DELETE": "true"},
+			want: defaultNamespaceTimeout + 5*5*time.Minute,
+		},
+		{
+			name: "every wait with custom timeouts",
+			env:  map[string]string{"SNAPSHOT_BEFORE_DELETE": "true", "WAIT_FOR_DELETION": "true", "SNAPSHOT_TIMEOUT": "1m", "DELETE_TIMEOUT": "30s"},
+			want: defaultNamespaceTimeout + 5*90*time.Second,
+		},
+		{
+			name: "explicit NAMESPACE_TIMEOUT fitting the waits",
+			env:  map[string]string{"WAIT_FOR_DELETION": "true", "NAMESPACE_TIMEOUT": "10m"},
+			want: 10 * time.Minute,
+		},
+		{
+			name: "explicit NAMESPACE_TIMEOUT disabled",
+			env:  map[string]string{"FORCE": "true", "NAMESPACE_TIMEOUT": "0"},
+			want: 0,
+		},
+		{
+			name:    "explicit NAMESPACE_TIMEOUT shorter than the waits",
+			env:     map[string]string{"WAIT_FOR_DELETION": "true", "NAMESPACE_TIMEOUT": "60s"},
+			wantErr: "DELETE_TIMEOUT (2m0s) must fit in NAMESPACE_TIMEOUT (1m0s)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OKTETO_URL", "https://okteto.example.com")
+			t.Setenv("OKTETO_TOKEN", "secret")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := loadConfig(nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig returned error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig returned an error: %s", err)
+			}
+			if cfg.NamespaceTimeout != tt.want {
+				t.Errorf("NAMESPACE_TIMEOUT is %s, want %s", cfg.NamespaceTimeout, tt.want)
+			}
+		})
+	}
+}
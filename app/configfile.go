@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig is the content of the YAML file passed with --config. Every setting is optional and
+// maps to the environment variable of the same name, which takes precedence over it
+type fileConfig struct {
+	OktetoURL              *string  `json:"oktetoURL"`
+	CredentialsFile        *string  `json:"credentialsFile"`
+	DryRun                 *bool    `json:"dryRun"`
+	DevPVCLabelSelector    *string  `json:"devPVCLabelSelector"`
+	IncludeNamespaces      []string `json:"includeNamespaces"`
+	ExcludeNamespaces      []string `json:"excludeNamespaces"`
+	ExcludeSystem          *bool    `json:"excludeSystemNamespaces"`
+	NamespaceRegex         *string  `json:"namespaceRegex"`
+	NamespaceScope         *string  `json:"namespaceScope"`
+	NamespaceLabelSelector *string  `json:"namespaceLabelSelector"`
+	DeleteInSlept          *bool    `json:"deleteInSlept"`
+	OnlySleptOlderThan     *string  `json:"onlySleptOlderThan"`
+	Sort                   *string  `json:"sort"`
+	MountedPodPhases       []string `json:"mountedPodPhases"`
+	CheckVolumeAttachments *bool    `json:"checkVolumeAttachments"`
+	CheckSharedPVs         *bool    `json:"checkSharedPVs"`
+	ScanAllMounts          *bool    `json:"scanAllNamespacesForMounts"`
+	ReclaimLock            *bool    `json:"reclaimLock"`
+	ReclaimLockTTL         *string  `json:"reclaimLockTTL"`
+	InstanceID             *string  `json:"instanceID"`
+	MinAge                 *string  `json:"minAge"`
+	MinNamespaceAge        *string  `json:"minNamespaceAge"`
+	GracePeriod            *string  `json:"gracePeriod"`
+	StateConfigMap         *string  `json:"stateConfigMap"`
+	StateNamespace         *string  `json:"stateConfigMapNamespace"`
+	KeepAnnotation         *string  `json:"keepAnnotation"`
+	TTLAnnotation          *string  `json:"ttlAnnotation"`
+	RequireBackupWithin    *string  `json:"requireBackupWithin"`
+	BackupAnnotation       *string  `json:"backupAnnotation"`
+	MinSize                *string  `json:"minSize"`
+	ProtectLabelSelector   *string  `json:"protectLabelSelector"`
+	DeleteOwned            *bool    `json:"deleteOwned"`
+	StorageClass           *string  `json:"storageClass"`
+	AllowedStorageClasses  []string `json:"allowedStorageClasses"`
+	PVCNameRegex           *string  `json:"pvcNameRegex"`
+	VolumeTypes            []string `json:"volumeTypes"`
+	DeleteOrphanPVs        *bool    `json:"deleteOrphanPVs"`
+	RecordEvents           *bool    `json:"recordEvents"`
+	PageSize               *int     `json:"pageSize"`
+	NamespaceTimeout       *string  `json:"namespaceTimeout"`
+	NamespaceJitter        *string  `json:"namespaceJitter"`
+	RunTimeout             *string  `json:"runTimeout"`
+	Output                 *string  `json:"output"`
+	Schedule               *string  `json:"schedule"`
+	HealthPort             *int     `json:"healthPort"`
+	LogFormat              *string  `json:"logFormat"`
+	LogBuffered            *bool    `json:"logBuffered"`
+	LogQuiet               *bool    `json:"logQuiet"`
+	LogLevel               *string  `json:"logLevel"`
+	DeletePropagation      *string  `json:"deletePropagation"`
+	WaitForDeletion        *bool    `json:"waitForDeletion"`
+	DeleteTimeout          *string  `json:"deleteTimeout"`
+	Force                  *bool    `json:"force"`
+	ForceFinalizers        []string `json:"forceFinalizers"`
+	SnapshotBeforeDelete   *bool    `json:"snapshotBeforeDelete"`
+	SnapshotClass          *string  `json:"snapshotClass"`
+	SnapshotTimeout        *string  `json:"snapshotTimeout"`
+	MaxRetries             *int     `json:"maxRetries"`
+	Concurrency            *int     `json:"concurrency"`
+	DeleteQPS              *float64 `json:"deleteQPS"`
+	MaxDeletions           *int     `json:"maxDeletions"`
+	HTTPTimeout            *string  `json:"httpTimeout"`
+	APIMaxRetries          *int     `json:"apiMaxRetries"`
+	InsecureSkipTLSVerify  *bool    `json:"insecureSkipTLSVerify"`
+	CACertFile             *string  `json:"caCertFile"`
+	APIHeaders             *string  `json:"apiHeaders"`
+	InCluster              *bool    `json:"inCluster"`
+	SkipKubeconfig         *bool    `json:"skipKubeconfig"`
+	KubeconfigCommand      *string  `json:"kubeconfigCommand"`
+	KubeconfigTimeout      *string  `json:"kubeconfigTimeout"`
+	KubeContext            *string  `json:"kubeContext"`
+	KubeServer             *string  `json:"kubeServer"`
+	SlackWebhookURL        *string  `json:"slackWebhookURL"`
+	WebhookURL             *string  `json:"webhookURL"`
+	PushgatewayURL         *string  `json:"pushgatewayURL"`
+	ReportCSV              *string  `json:"reportCSV"`
+	FailOnError            *bool    `json:"failOnError"`
+	FailOnEmpty            *bool    `json:"failOnEmpty"`
+}
+
+// env returns the settings of the file keyed by the name of their environment variable
+func (f *fileConfig) env() map[string]string {
+	env := make(map[string]string)
+	setString := func(name string, value *string) {
+		if value != nil {
+			env[name] = *value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			env[name] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(name string, value *int) {
+		if value != nil {
+			env[name] = strconv.Itoa(*value)
+		}
+	}
+	setList := func(name string, value []string) {
+		if len(value) > 0 {
+			env[name] = strings.Join(value, ",")
+		}
+	}
+
+	setString("OKTETO_URL", f.OktetoURL)
+	setString("OKTETO_CREDENTIALS_FILE", f.CredentialsFile)
+	setBool("DRY_RUN", f.DryRun)
+	setString("DEV_PVC_LABEL_SELECTOR", f.DevPVCLabelSelector)
+	setList("INCLUDE_NAMESPACES", f.IncludeNamespaces)
+	setList("EXCLUDE_NAMESPACES", f.ExcludeNamespaces)
+	setBool("EXCLUDE_SYSTEM_NAMESPACES", f.ExcludeSystem)
+	setString("NAMESPACE_REGEX", f.NamespaceRegex)
+	setString("NAMESPACE_SCOPE", f.NamespaceScope)
+	setString("NAMESPACE_LABEL_SELECTOR", f.NamespaceLabelSelector)
+	setBool("DELETE_IN_SLEPT", f.DeleteInSlept)
+	setString("ONLY_SLEPT_OLDER_THAN", f.OnlySleptOlderThan)
+	setString("SORT", f.Sort)
+	setList("MOUNTED_POD_PHASES", f.MountedPodPhases)
+	setBool("CHECK_VOLUME_ATTACHMENTS", f.CheckVolumeAttachments)
+	setBool("CHECK_SHARED_PVS", f.CheckSharedPVs)
+	setBool("SCAN_ALL_NAMESPACES_FOR_MOUNTS", f.ScanAllMounts)
+	setBool("RECLAIM_LOCK", f.ReclaimLock)
+	setString("RECLAIM_LOCK_TTL", f.ReclaimLockTTL)
+	setString("INSTANCE_ID", f.InstanceID)
+	setString("MIN_AGE", f.MinAge)
+	setString("MIN_NAMESPACE_AGE", f.MinNamespaceAge)
+	setString("GRACE_PERIOD", f.GracePeriod)
+	setString("STATE_CONFIGMAP", f.StateConfigMap)
+	setString("STATE_CONFIGMAP_NAMESPACE", f.StateNamespace)
+	setString("KEEP_ANNOTATION", f.KeepAnnotation)
+	setString("TTL_ANNOTATION", f.TTLAnnotation)
+	setString("REQUIRE_BACKUP_WITHIN", f.RequireBackupWithin)
+	setString("BACKUP_ANNOTATION", f.BackupAnnotation)
+	setString("MIN_SIZE", f.MinSize)
+	setString("PROTECT_LABEL_SELECTOR", f.ProtectLabelSelector)
+	setBool("DELETE_OWNED", f.DeleteOwned)
+	setString("STORAGE_CLASS", f.StorageClass)
+	setList("ALLOWED_STORAGE_CLASSES", f.AllowedStorageClasses)
+	setString("PVC_NAME_REGEX", f.PVCNameRegex)
+	setList("VOLUME_TYPES", f.VolumeTypes)
+	setBool("DELETE_ORPHAN_PVS", f.DeleteOrphanPVs)
+	setBool("RECORD_EVENTS", f.RecordEvents)
+	setInt("PAGE_SIZE", f.PageSize)
+	setString("NAMESPACE_TIMEOUT", f.NamespaceTimeout)
+	setString("NAMESPACE_JITTER", f.NamespaceJitter)
+	setString("RUN_TIMEOUT", f.RunTimeout)
+	setString("OUTPUT", f.Output)
+	setString("SCHEDULE", f.Schedule)
+	setInt("HEALTH_PORT", f.HealthPort)
+	setString("LOG_FORMAT", f.LogFormat)
+	setBool("LOG_BUFFERED", f.LogBuffered)
+	setBool("LOG_QUIET", f.LogQuiet)
+	setString("LOG_LEVEL", f.LogLevel)
+	setString("DELETE_PROPAGATION", f.DeletePropagation)
+	setBool("WAIT_FOR_DELETION", f.WaitForDeletion)
+	setString("DELETE_TIMEOUT", f.DeleteTimeout)
+	setBool("FORCE", f.Force)
+	setList("FORCE_FINALIZERS", f.ForceFinalizers)
+	setBool("SNAPSHOT_BEFORE_DELETE", f.SnapshotBeforeDelete)
+	setString("SNAPSHOT_CLASS", f.SnapshotClass)
+	setString("SNAPSHOT_TIMEOUT", f.SnapshotTimeout)
+	setInt("MAX_RETRIES", f.MaxRetries)
+	setInt("CONCURRENCY", f.Concurrency)
+	if f.DeleteQPS != nil {
+		env["DELETE_QPS"] = strconv.FormatFloat(*f.DeleteQPS, 'f', -1, 64)
+	}
+	setInt("MAX_DELETIONS", f.MaxDeletions)
+	setString("HTTP_TIMEOUT", f.HTTPTimeout)
+	setInt("API_MAX_RETRIES", f.APIMaxRetries)
+	setBool("OKTETO_INSECURE_SKIP_TLS_VERIFY", f.InsecureSkipTLSVerify)
+	setString("OKTETO_CA_CERT_FILE", f.CACertFile)
+	setString("OKTETO_API_HEADERS", f.APIHeaders)
+	setBool("IN_CLUSTER", f.InCluster)
+	setBool("SKIP_KUBECONFIG", f.SkipKubeconfig)
+	setString("KUBECONFIG_COMMAND", f.KubeconfigCommand)
+	setString("KUBECONFIG_TIMEOUT", f.KubeconfigTimeout)
+	setString("KUBE_CONTEXT", f.KubeContext)
+	setString("KUBE_SERVER", f.KubeServer)
+	setString("SLACK_WEBHOOK_URL", f.SlackWebhookURL)
+	setString("WEBHOOK_URL", f.WebhookURL)
+	setString("PUSHGATEWAY_URL", f.PushgatewayURL)
+	setString("REPORT_CSV", f.ReportCSV)
+	setBool("FAIL_ON_ERROR", f.FailOnError)
+	setBool("FAIL_ON_EMPTY", f.FailOnEmpty)
+
+	return env
+}
+
+// applyConfigFile reads the YAML config file at path and sets the environment variables of the settings
+// it defines, unless they are already set in the environment
+func applyConfigFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading the config file: %w", err)
+	}
+
+	var f fileConfig
+	if err := yaml.UnmarshalStrict(b, &f); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for name, value := range f.env() {
+		if os.Getenv(name) != "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// credentialsFile is the content of the file referenced by OKTETO_CREDENTIALS_FILE
+type credentialsFile struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// readCredentialsFile returns the Okteto URL and token in the YAML or JSON file at path. Other keys are ignored
+func readCredentialsFile(path string) (credentialsFile, error) {
+	var creds credentialsFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return creds, fmt.Errorf("error reading OKTETO_CREDENTIALS_FILE: %w", err)
+	}
+
+	if err := yaml.Unmarshal(b, &creds); err != nil {
+		return creds, fmt.Errorf("error parsing OKTETO_CREDENTIALS_FILE %s: %w", path, err)
+	}
+
+	return creds, nil
+}
+
+// configFilePath returns the value of the --config flag in args, or CONFIG_FILE if the flag is not set.
+// The flag is looked up before parsing the rest of the flags because their defaults depend on the config file
+func configFilePath(args []string) string {
+	if value, ok := lookupFlag(args, "config"); ok {
+		return value
+	}
+
+	return os.Getenv("CONFIG_FILE")
+}
+
+// lookupFlag returns the value of the flag with the given name in args, and whether it is set.
+// It is used for the flags that must be known before the configuration is loaded
+func lookupFlag(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || flagName != name {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			return args[i+1], true
+		}
+		return "", true
+	}
+
+	return "", false
+}
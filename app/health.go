@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// defaultHealthPort is the port of the health server when SCHEDULE is set and HEALTH_PORT is not
+const defaultHealthPort = 8080
+
+// healthServer serves the liveness and readiness probes of the process
+type healthServer struct {
+	server *http.Server
+	ready  atomic.Bool
+}
+
+// startHealthServer starts serving /healthz and /readyz on the given port. /healthz always succeeds
+// while the process is up, and /readyz succeeds once setReady is called
+func startHealthServer(port int, logger *slog.Logger) (*healthServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("error starting the health server: %w", err)
+	}
+
+	h := &healthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !h.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	h.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := h.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(fmt.Sprintf("The health server stopped: %s", err))
+		}
+	}()
+	logger.Info(fmt.Sprintf("Serving health probes on port %d", port))
+
+	return h, nil
+}
+
+// setReady makes /readyz succeed. It does nothing on a nil server, so it can be called without a health server
+func (h *healthServer) setReady() {
+	if h == nil {
+		return
+	}
+	h.ready.Store(true)
+}
+
+// shutdown stops the health server
+func (h *healthServer) shutdown(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_ = h.server.Shutdown(ctx)
+}
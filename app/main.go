@@ -1,189 +1,553 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/okteto-community/delete-unused-dev-volumes/app/api"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/cleaner"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/metrics"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/model"
+	"github.com/okteto-community/delete-unused-dev-volumes/app/notify"
+	"golang.org/x/time/rate"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-const oktetoKubeconfigCommand = "okteto kubeconfig"
-
 func main() {
-	ctx := context.Background()
-	token := os.Getenv("OKTETO_TOKEN")
-	oktetoURL := os.Getenv("OKTETO_URL")
+	os.Exit(run())
+}
+
+// run executes the cleanup, once or on the configured schedule, and returns the exit code of the process
+func run() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The version is printed before loading the configuration, so it works without any setting
+	if _, ok := lookupFlag(os.Args[1:], "version"); ok {
+		fmt.Println(versionString())
+		return 0
+	}
 
 	logLevel := &slog.LevelVar{} // INFO
-	opts := &slog.HandlerOptions{
-		Level: logLevel,
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		newLogger(logFormatText, logLevel, os.Stdout).Error(fmt.Sprintf("Invalid configuration: %s", err))
+		return 1
+	}
+	logLevel.Set(cfg.logLevel)
+	// With OUTPUT=json stdout only has the JSON document of the run, so the logs go to stderr
+	logOutput := io.Writer(os.Stdout)
+	if cfg.output == outputJSON {
+		logOutput = os.Stderr
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, opts))
+	logger := newLogger(cfg.logFormat, logLevel, logOutput)
+
+	// In quiet mode the summary of the run is still logged at the configured level, while the rest of the
+	// logs must be warnings or errors
+	summaryLogger := logger
+	if cfg.quiet {
+		quietLevel := &slog.LevelVar{}
+		quietLevel.Set(max(cfg.logLevel, slog.LevelWarn))
+		logger = newLogger(cfg.logFormat, quietLevel, logOutput)
+	}
+	logger.Info(fmt.Sprintf("Starting %s", versionString()))
+
+	// After the first shutdown signal the namespace in progress is completed. The signals are then restored to their
+	// default behavior, so a second one kills the process at once
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			logger.Warn("Received a shutdown signal, finishing the namespace in progress. Send it again to exit immediately")
+		case <-exited:
+		}
+	}()
 
-	if token == "" || oktetoURL == "" {
-		logger.Error("OKTETO_TOKEN and OKTETO_URL environment variables are required")
-		os.Exit(1)
+	if cfg.deleteNotConfirmed {
+		logger.Warn("=====================================================================")
+		logger.Warn(fmt.Sprintf("CONFIRM_DELETE is not set to %q, so NO PVC WILL BE DELETED", confirmDeleteToken))
+		logger.Warn(fmt.Sprintf("Running in dry-run mode. Set CONFIRM_DELETE=%s to delete the unused dev PVCs", confirmDeleteToken))
+		logger.Warn("=====================================================================")
 	}
 
-	u, err := url.Parse(oktetoURL)
-	if err != nil {
-		logger.Error(fmt.Sprintf("Invalid OKTETO_URL %s", err))
-		os.Exit(1)
+	switch {
+	case cfg.planFile != "":
+		logger.Info(fmt.Sprintf("Writing the plan to %s, no PVC will be deleted", cfg.planFile))
+	case cfg.DryRun:
+		logger.Info("Running in dry-run mode, no PVC will be deleted")
 	}
 
-	nsList, err := api.GetNamespaces(u.Host, token, logger)
-	if err != nil {
-		logger.Error(fmt.Sprintf("There was an error requesting the namespaces: %s", err))
-		os.Exit(1)
+	if cfg.ApplyPlan != nil {
+		logger.Info(fmt.Sprintf("Applying the plan %s written at %s with %d PVCs", cfg.applyFile, cfg.ApplyPlan.CreatedAt.Format(time.RFC3339), len(cfg.ApplyPlan.PVCs)))
 	}
 
-	tempDir, err := os.MkdirTemp("", "")
-	if err != nil {
-		logger.Error(fmt.Sprintf("There was an error creating a temporary directory: %s", err))
-		os.Exit(1)
+	if cfg.Interactive && !cfg.AssumeYes && !cleaner.IsInteractiveTerminal() {
+		logger.Info("Stdin is not a terminal, deletions will be confirmed automatically")
+		cfg.AssumeYes = true
 	}
-	defer os.RemoveAll(tempDir)
 
-	kubeconfigPath := fmt.Sprintf("%s/.kube/config", tempDir)
-	_ = os.Setenv("KUBECONFIG", kubeconfigPath)
+	if !cfg.inCluster && !cfg.skipKubeconfig {
+		// Fail fast with a clear message instead of an exec error when the kubeconfig of the first instance is generated
+		program := commandArgs(cfg.kubeconfigCommand)[0]
+		if _, err := exec.LookPath(program); err != nil {
+			logger.Error(fmt.Sprintf("%q was not found in PATH. Install the Okteto CLI (https://www.okteto.com/docs/get-started/install-okteto-cli/), set KUBECONFIG_COMMAND to its location, or use IN_CLUSTER or SKIP_KUBECONFIG", program))
+			return 1
+		}
+	}
 
-	output, err := createKubeconfig()
-	if err != nil {
-		logger.Error(fmt.Sprintf("There was an error creating the kubeconfig: %s", err))
-		os.Exit(1)
+	if cfg.Force && cfg.ForceFinalizers[cleaner.PVCProtectionFinalizer] {
+		logger.Warn(fmt.Sprintf("FORCE_FINALIZERS includes %s, so a stuck PVC that a pod has just started using can be deleted with its data", cleaner.PVCProtectionFinalizer))
 	}
-	logger.Info(output)
 
-	clientset, err := getKubernetesClient(kubeconfigPath)
-	if err != nil {
-		logger.Error(fmt.Sprintf("There was an error creating the Kubernetes client: %s", err))
-		os.Exit(1)
+	if cfg.insecureSkipTLSVerify {
+		logger.Warn("The TLS certificate of the Okteto API is not verified because OKTETO_INSECURE_SKIP_TLS_VERIFY is enabled. Do not use it in production")
 	}
-	for _, ns := range nsList {
-		logger.Info(fmt.Sprintf("Checking namespace '%s'", ns.Name))
 
-		// We retrieve all the PersistentVolumeClaims mounted in pods in the namespace
-		mountedPVCs, err := getMountedPVCs(ctx, clientset, ns.Name)
+	healthPort := cfg.healthPort
+	if healthPort == 0 && cfg.schedule != "" {
+		healthPort = defaultHealthPort
+	}
+	// health is nil without a health server, and it is marked ready once a Kubernetes client is built
+	var health *healthServer
+	if healthPort > 0 {
+		var err error
+		health, err = startHealthServer(healthPort, logger)
 		if err != nil {
-			logger.Error(fmt.Sprintf("Skipping ns %q because there was an error checking PVCs for namespace: %s", ns.Name, err))
-			logger.Info("-----------------------------------------------")
-			continue
+			logger.Error(err.Error())
+			return 1
 		}
+		defer health.shutdown(context.WithoutCancel(ctx))
+	}
 
-		// We retrieve all the PersistentVolumeClaims created by Okteto for development containers in the namespace
-		devPVCs, err := getOktetoDevPVCs(ctx, clientset, ns.Name)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Skipping ns %q because there was an error checking dev PVCs for namespace: %s", ns.Name, err))
-			logger.Info("-----------------------------------------------")
-			continue
-		}
+	if cfg.schedule != "" {
+		return runScheduled(ctx, cfg, health, logger, summaryLogger)
+	}
+
+	return cleanup(ctx, cfg, health, logger, summaryLogger)
+}
 
-		if len(devPVCs) == 0 {
-			logger.Info(fmt.Sprintf("Skipping ns %q because there are no dev PVCs", ns.Name))
+// cleanup deletes the unused dev PVCs of all the Okteto instances, reports the outcome and returns the exit code of the run.
+// The summary of the run is logged with summaryLogger, so it is kept in quiet mode
+func cleanup(ctx context.Context, cfg *config, health *healthServer, logger, summaryLogger *slog.Logger) int {
+	startTime := time.Now()
+
+	// The namespace being processed when the deadline is reached is still completed, within the namespace timeout
+	ctx, cancel := withOptionalTimeout(ctx, cfg.runTimeout)
+	defer cancel()
+	limiter := cleaner.NewDeleteLimiter(cfg.DeleteQPS)
+	budget := cleaner.NewBudget(cfg.MaxDeletions)
+
+	var total cleaner.Report
+	failedInstances := 0
+	for _, inst := range cfg.instances {
+		if ctx.Err() != nil || budget.Reached() {
+			break
 		}
 
-		// For each dev PVC, we delete it if it is not mounted in any pod
-		for _, devPVC := range devPVCs {
-			if _, ok := mountedPVCs[devPVC]; ok {
-				logger.Info(fmt.Sprintf("Skipping PVC %q in namespace %q because it is mounted in a pod", devPVC, ns.Name))
-				continue
-			}
+		if len(cfg.instances) > 1 {
+			logger.Info(fmt.Sprintf("Cleaning up Okteto instance %s", inst.url))
+		}
 
-			if err := deletePVC(ctx, clientset, ns.Name, devPVC); err != nil {
-				logger.Error(fmt.Sprintf("Error deleting PVC %q in namespace %q: %s", devPVC, ns.Name, err))
+		instanceReport, err := cleanInstance(ctx, cfg, inst, limiter, budget, health, logger)
+		if err != nil {
+			if len(cfg.instances) > 1 {
+				logger.Error(fmt.Sprintf("Skipping Okteto instance %s: %s", inst.url, err))
 			} else {
-				logger.Info(fmt.Sprintf("Deleted PVC %q in namespace %q", devPVC, ns.Name))
+				logger.Error(fmt.Sprintf("Stopping the run: %s", err))
 			}
+			failedInstances++
 		}
+		total.Merge(instanceReport)
+	}
 
-		logger.Info("-----------------------------------------------")
+	// The duration of the run includes the requests to the Okteto API and the generation of the kubeconfigs
+	total.Duration = time.Since(startTime)
+	total.Log(summaryLogger, cfg.DryRun, cfg.DeleteOrphanPVs)
+	if cfg.DryRun {
+		total.LogDiff(summaryLogger)
+	}
+	if cfg.explain {
+		total.LogExplain(summaryLogger, cfg.DryRun)
+	}
+	if cfg.top > 0 {
+		total.LogTop(summaryLogger, cfg.top, cfg.DryRun)
+	}
+	if stuck := total.StuckClaims(); len(stuck) > 0 {
+		logger.Warn(fmt.Sprintf("%d PVCs were still being deleted after %s, check their finalizers: %s", len(stuck), cfg.DeleteTimeout, strings.Join(stuck, ", ")))
 	}
-}
 
-// deletePVC deletes the PersistentVolumeClaim with the given name in the given namespace
-func deletePVC(ctx context.Context, clientset *kubernetes.Clientset, namespace, pvcName string) error {
-	err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, metav1.DeleteOptions{})
-	if err != nil {
-		return err
+	if cfg.planFile != "" {
+		if err := cleaner.WritePlan(cfg.planFile, cleaner.NewPlan(&total)); err != nil {
+			logger.Error(fmt.Sprintf("There was an error writing the plan: %s", err))
+			return 1
+		}
+		summaryLogger.Info(fmt.Sprintf("Plan with %d PVCs written to %s", total.Deleted, cfg.planFile))
+	}
+
+	if cfg.output == outputJSON {
+		if err := cleaner.WriteJSONOutput(os.Stdout, &total, cfg.DryRun); err != nil {
+			logger.Error(fmt.Sprintf("There was an error writing the JSON output: %s", err))
+		}
+	}
+
+	if cfg.reportCSV != "" {
+		if err := cleaner.WriteCSVReport(cfg.reportCSV, &total, cfg.DryRun); err != nil {
+			logger.Error(fmt.Sprintf("There was an error writing the CSV report: %s", err))
+		} else {
+			summaryLogger.Info(fmt.Sprintf("CSV report written to %s", cfg.reportCSV))
+		}
+	}
+
+	if cfg.slackWebhookURL != "" {
+		// The notification is sent even if the run was interrupted, so it must not depend on the cancelled context
+		if err := notify.SendSlack(context.WithoutCancel(ctx), cfg.slackWebhookURL, total.Notification(cfg.DryRun)); err != nil {
+			logger.Error(fmt.Sprintf("There was an error sending the Slack notification: %s", err))
+		}
+	}
+
+	if cfg.webhookURL != "" {
+		if err := notify.SendWebhook(context.WithoutCancel(ctx), cfg.webhookURL, total.WebhookReport(startTime, cfg.instanceURLs(), cfg.DryRun)); err != nil {
+			logger.Error(fmt.Sprintf("There was an error sending the run report to the webhook: %s", err))
+		}
+	}
+
+	if cfg.pushgatewayURL != "" {
+		if err := metrics.Push(context.WithoutCancel(ctx), cfg.pushgatewayURL, cfg.DryRun, total.Metrics()); err != nil {
+			logger.Error(fmt.Sprintf("There was an error pushing the metrics to the Pushgateway: %s", err))
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Error(fmt.Sprintf("The run was cut short because it reached RUN_TIMEOUT (%s), the summary only includes the namespaces processed until then", cfg.runTimeout))
+		return 1
+	}
+
+	if ctx.Err() != nil {
+		return 1
+	}
+
+	if budget.Reached() {
+		logger.Error(fmt.Sprintf("The run was stopped because it reached the maximum number of deletions (%d). Check the configuration or raise MAX_DELETIONS", cfg.MaxDeletions))
+		return 1
+	}
+
+	if failedInstances > 0 {
+		return 1
+	}
+
+	if total.Errors > 0 && cfg.failOnError {
+		logger.Error(fmt.Sprintf("The run finished with %d errors", total.Errors))
+		return 1
 	}
 
-	return nil
+	return 0
 }
 
-// getOktetoDevPVCs returns the names of the PersistentVolumeClaims created by Okteto for development containers in the given namespace
-func getOktetoDevPVCs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]string, error) {
-	labelSelector := fmt.Sprintf("dev.okteto.com=true")
-	opts := metav1.ListOptions{
-		LabelSelector: labelSelector,
+// cleanInstance deletes the unused dev PVCs of the namespaces of the given Okteto instance.
+// It returns an error if the namespaces or the Kubernetes client of the instance could not be retrieved.
+// health is marked ready once the Kubernetes client is built
+func cleanInstance(ctx context.Context, cfg *config, inst instance, limiter *rate.Limiter, budget *cleaner.Budget, health *healthServer, logger *slog.Logger) (cleaner.Report, error) {
+	var total cleaner.Report
+
+	var nsList []model.Namespace
+	if len(cfg.namespaces) > 0 {
+		// The namespaces set explicitly are processed as they are, without calling the Okteto API nor filtering them
+		logger.Info(fmt.Sprintf("Processing the %d namespaces set with --namespaces", len(cfg.namespaces)))
+		for _, name := range cfg.namespaces {
+			nsList = append(nsList, model.Namespace{Name: name})
+		}
+	} else {
+		u, err := url.Parse(inst.url)
+		if err != nil {
+			return total, fmt.Errorf("invalid OKTETO_URL %s", err)
+		}
+
+		nsList, err = api.GetNamespaces(ctx, u.Host, inst.token, cfg.apiOptions(), logger)
+		if err != nil {
+			return total, fmt.Errorf("there was an error requesting the namespaces: %w", err)
+		}
+
+		// A new instance or a token with a restricted scope returns no namespaces, which would look like a successful run
+		if len(nsList) == 0 {
+			logger.Warn("No namespaces returned from Okteto API; check token scope")
+			if cfg.failOnEmpty {
+				return total, fmt.Errorf("the Okteto API returned no namespaces and FAIL_ON_EMPTY is enabled")
+			}
+		}
+
+		if len(cfg.includeNamespaces) > 0 {
+			nsList = filterIncludedNamespaces(nsList, cfg.includeNamespaces, logger)
+		}
+
+		if cfg.namespaceRegex != nil {
+			nsList = filterNamespacesByRegex(nsList, cfg.namespaceRegex, logger)
+		}
+
+		if cfg.namespaceScope != scopeAll {
+			nsList = filterNamespacesByScope(nsList, cfg.namespaceScope, logger)
+		}
+	}
+
+	if cfg.ApplyPlan != nil {
+		nsList = filterIncludedNamespaces(nsList, cfg.ApplyPlan.Namespaces(inst.url), logger)
+	}
+
+	var kubeconfigPath string
+	switch {
+	case cfg.inCluster:
+		// In-cluster mode uses the ServiceAccount mounted in the pod, so there is no need to generate a kubeconfig with the Okteto CLI
+	case cfg.skipKubeconfig:
+		// kubeconfigPath is left empty, so the kubeconfig is loaded from KUBECONFIG, which may list several files, or ~/.kube/config
+		logger.Info(fmt.Sprintf("Using the existing kubeconfig %s", strings.Join(clientcmd.NewDefaultClientConfigLoadingRules().Precedence, string(os.PathListSeparator))))
+	default:
+		tempDir, err := os.MkdirTemp("", "")
+		if err != nil {
+			return total, fmt.Errorf("there was an error creating a temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		kubeconfigPath = fmt.Sprintf("%s/.kube/config", tempDir)
+		output, err := createKubeconfig(ctx, cfg.kubeconfigCommand, cfg.kubeconfigTimeout, kubeconfigPath, inst)
+		if err != nil {
+			return total, fmt.Errorf("there was an error creating the kubeconfig: %w", err)
+		}
+		logger.Info(output)
 	}
-	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+
+	restConfig, err := getKubernetesConfig(kubeconfigPath, cfg.inCluster, cfg.kubeContext, cfg.kubeServer)
 	if err != nil {
-		return nil, err
+		return total, fmt.Errorf("there was an error creating the Kubernetes client: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return total, fmt.Errorf("there was an error creating the Kubernetes client: %w", err)
+	}
+
+	// The kubeconfig works and the client is built, so the process is able to run the cleanup
+	health.setReady()
+
+	if cfg.namespaceLabelSelector != "" && len(cfg.namespaces) == 0 {
+		logger.Info(fmt.Sprintf("Filtering namespaces with label selector %q. The Okteto API does not return namespace labels, so they are read from the Kubernetes API", cfg.namespaceLabelSelector))
+		nsList, err = filterNamespacesByLabels(ctx, clientset, nsList, cfg.namespaceLabelSelector, logger)
+		if err != nil {
+			return total, fmt.Errorf("there was an error filtering the namespaces by labels: %w", err)
+		}
 	}
 
-	var devPVCs []string
-	for _, pvc := range pvcs.Items {
-		devPVCs = append(devPVCs, pvc.Name)
+	// VolumeSnapshots are not part of the core API, so they are created with the dynamic client
+	var dynamicClient dynamic.Interface
+	if cfg.SnapshotBeforeDelete {
+		dynamicClient, err = dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return total, fmt.Errorf("there was an error creating the Kubernetes dynamic client: %w", err)
+		}
 	}
 
-	return devPVCs, nil
+	c := cleaner.New(clientset, &cfg.Options, logger)
+	c.DynamicClient = dynamicClient
+	c.Limiter = limiter
+	c.Budget = budget
+	c.InstanceURL = inst.url
+	c.Namespaces = nsList
+	return c.Run(ctx)
 }
 
-// getMountedPVCs returns a map of PersistentVolumeClaims mounted in pods in the given namespace
-func getMountedPVCs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (map[string]bool, error) {
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+// withOptionalTimeout returns a copy of ctx that is cancelled after timeout. A zero timeout disables the deadline
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// newLogger creates a logger writing to w in the given format
+func newLogger(format string, level slog.Leveler, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+	if format == logFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
 	}
 
-	mountedPVCs := make(map[string]bool)
-	for _, pod := range pods.Items {
-		if len(pod.Spec.Volumes) == 0 {
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// filterIncludedNamespaces returns the namespaces of nsList that are in the include list
+func filterIncludedNamespaces(nsList []model.Namespace, include map[string]bool, logger *slog.Logger) []model.Namespace {
+	var filtered []model.Namespace
+	for _, ns := range nsList {
+		if !include[ns.Name] {
+			logger.Info(fmt.Sprintf("Skipping namespace %q because it is not in the include list", ns.Name))
 			continue
 		}
+		filtered = append(filtered, ns)
+	}
 
-		for _, volume := range pod.Spec.Volumes {
-			if volume.PersistentVolumeClaim == nil {
-				continue
-			}
+	return filtered
+}
 
-			mountedPVCs[volume.PersistentVolumeClaim.ClaimName] = true
+// filterNamespacesByRegex returns the namespaces of nsList whose name matches re
+func filterNamespacesByRegex(nsList []model.Namespace, re *regexp.Regexp, logger *slog.Logger) []model.Namespace {
+	var filtered []model.Namespace
+	for _, ns := range nsList {
+		if !re.MatchString(ns.Name) {
+			logger.Info(fmt.Sprintf("Skipping namespace %q because it does not match %q", ns.Name, re.String()))
+			continue
 		}
+		filtered = append(filtered, ns)
 	}
 
-	return mountedPVCs, nil
+	return filtered
 }
 
-// createKubeconfig executes the Okteto CLI command to set the kubeconfig to talk with Okteto's cluster
-func createKubeconfig() (string, error) {
-	cmd := exec.Command("bash", "-c", oktetoKubeconfigCommand)
+// filterNamespacesByScope returns the namespaces of nsList that are personal namespaces if scope is scopePersonal,
+// or shared namespaces if scope is scopeShared
+func filterNamespacesByScope(nsList []model.Namespace, scope string, logger *slog.Logger) []model.Namespace {
+	var filtered []model.Namespace
+	for _, ns := range nsList {
+		if ns.Personal != (scope == scopePersonal) {
+			logger.Info(fmt.Sprintf("Skipping namespace %q because it is not a %s namespace", ns.Name, scope))
+			continue
+		}
+		filtered = append(filtered, ns)
+	}
 
-	out, err := cmd.CombinedOutput()
+	return filtered
+}
+
+// filterNamespacesByLabels returns the namespaces of nsList whose Kubernetes labels match labelSelector
+func filterNamespacesByLabels(ctx context.Context, clientset kubernetes.Interface, nsList []model.Namespace, labelSelector string, logger *slog.Logger) ([]model.Namespace, error) {
+	matching, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 	if err != nil {
+		return nil, cleaner.CheckForbidden(err, "list", "", "namespaces")
+	}
+
+	matchingNames := make(map[string]bool, len(matching.Items))
+	for _, ns := range matching.Items {
+		matchingNames[ns.Name] = true
+	}
+
+	var filtered []model.Namespace
+	for _, ns := range nsList {
+		if !matchingNames[ns.Name] {
+			logger.Info(fmt.Sprintf("Skipping namespace %q because its labels do not match %q", ns.Name, labelSelector))
+			continue
+		}
+		filtered = append(filtered, ns)
+	}
+
+	return filtered, nil
+}
+
+// createKubeconfig executes the given Okteto CLI command to write the kubeconfig to talk with the cluster of the given Okteto instance to kubeconfigPath.
+// The command is killed if it takes longer than timeout or ctx is cancelled, such as on shutdown
+func createKubeconfig(ctx context.Context, command string, timeout time.Duration, kubeconfigPath string, inst instance) (string, error) {
+	ctx, cancel := withOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	args := commandArgs(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("KUBECONFIG=%s", kubeconfigPath),
+		fmt.Sprintf("OKTETO_URL=%s", inst.url),
+		fmt.Sprintf("OKTETO_TOKEN=%s", inst.token),
+	)
+
+	// Stderr is kept apart so that the error reported when the CLI fails is not mixed with its regular output
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("%q did not finish after %s", command, timeout)
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%q was cancelled: %w", command, ctx.Err())
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
 		return "", err
 	}
 
 	return string(out), nil
 }
 
-// getKubernetesClient creates a kubernetes client with the kubeconfig in the server
-func getKubernetesClient(kubeconfigPath string) (*kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("error building k8s config from flags: %w", err)
+// commandArgs splits command into the program and its arguments. Commands using shell features,
+// such as quotes, pipes or variables, are run through bash instead
+func commandArgs(command string) []string {
+	if strings.ContainsAny(command, "\"'`$|&;<>()*?~\\") {
+		return []string{"bash", "-c", command}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
+	return strings.Fields(command)
+}
+
+// buildKubeconfigConfig returns the client configuration of the given context of the kubeconfig at kubeconfigPath,
+// or of its current context if kubeContext is empty. A non-empty server overrides the URL of the API server.
+// An empty kubeconfigPath loads the files listed in KUBECONFIG, merged like kubectl does, or ~/.kube/config
+func buildKubeconfigConfig(kubeconfigPath, kubeContext, server string) (*rest.Config, error) {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}
+	if kubeconfigPath == "" {
+		rules = clientcmd.NewDefaultClientConfigLoadingRules()
+		kubeconfigPath = strings.Join(rules.Precedence, string(os.PathListSeparator))
+	}
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+		ClusterInfo:    clientcmdapi.Cluster{Server: server},
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	if kubeContext != "" {
+		raw, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := raw.Contexts[kubeContext]; !ok {
+			return nil, fmt.Errorf("context %q not found in %s", kubeContext, kubeconfigPath)
+		}
+	}
+
+	return clientConfig.ClientConfig()
+}
+
+// getKubernetesConfig returns the configuration of the kubernetes clients with the kubeconfig in the server, or with the pod ServiceAccount if inCluster is true
+func getKubernetesConfig(kubeconfigPath string, inCluster bool, kubeContext, server string) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+	if inCluster {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error building in-cluster k8s config: %w", err)
+		}
+	} else {
+		config, err = buildKubeconfigConfig(kubeconfigPath, kubeContext, server)
+		if err != nil {
+			return nil, fmt.Errorf("error building k8s config from flags: %w", err)
+		}
 	}
 
-	return clientset, nil
+	return config, nil
 }
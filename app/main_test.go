@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestKubeconfig writes a kubeconfig with a single context named like the cluster and returns its path
+func writeTestKubeconfig(t *testing.T, name, server string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: %[2]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+users:
+- name: %[1]s
+  user:
+    token: secret
+current-context: %[1]s
+`, name, server)
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatalf("writing the kubeconfig: %s", err)
+	}
+
+	return path
+}
+
+func TestBuildKubeconfigConfigMergesKubeconfigList(t *testing.T) {
+	first := writeTestKubeconfig(t, "cindy", "https://cindy.example.com")
+	second := writeTestKubeconfig(t, "rberrelleza", "https://rberrelleza.example.com")
+	t.Setenv("KUBECONFIG", first+string(os.PathListSeparator)+second)
+
+	config, err := buildKubeconfigConfig("", "rberrelleza", "")
+	if err != nil {
+		t.Fatalf("buildKubeconfigConfig returned an error: %s", err)
+	}
+	if config.Host != "https://rberrelleza.example.com" {
+		t.Errorf("got server %q, want the one of the context in the second file", config.Host)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// jobName is the job label of the metrics pushed to the Pushgateway
+const jobName = "delete_unused_dev_volumes"
+
+// Namespace holds the outcome of processing a namespace
+type Namespace struct {
+	Name string
+
+	// OktetoURL is the Okteto instance of the namespace
+	OktetoURL string
+
+	// Deleted is the number of PVCs deleted
+	Deleted int
+
+	// Skipped is the number of dev PVCs kept, indexed by reason
+	Skipped map[string]int
+
+	// DeleteErrors is the number of PVCs that could not be deleted
+	DeleteErrors int
+
+	// ReclaimedBytes is the storage requested by the deleted PVCs
+	ReclaimedBytes int64
+
+	// Duration is the time spent processing the namespace
+	Duration time.Duration
+}
+
+// Push sends the metrics of a run to the Pushgateway at url. The metrics of each run replace the ones of the previous run
+func Push(ctx context.Context, url string, dryRun bool, namespaces []Namespace) error {
+	deleted := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dev_volumes_deleted_total",
+		Help: "Number of dev PVCs deleted.",
+	}, []string{"okteto_url", "namespace"})
+	skipped := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dev_volumes_skipped_total",
+		Help: "Number of dev PVCs kept, by reason.",
+	}, []string{"okteto_url", "namespace", "reason"})
+	deleteErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dev_volumes_delete_errors_total",
+		Help: "Number of dev PVCs that could not be deleted.",
+	}, []string{"okteto_url", "namespace"})
+	reclaimed := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dev_volumes_reclaimed_bytes_total",
+		Help: "Storage requested by the deleted dev PVCs, in bytes.",
+	}, []string{"okteto_url", "namespace"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dev_volumes_namespace_duration_seconds",
+		Help:    "Time spent processing each namespace, in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"okteto_url"})
+
+	for _, ns := range namespaces {
+		duration.WithLabelValues(ns.OktetoURL).Observe(ns.Duration.Seconds())
+		deleted.WithLabelValues(ns.OktetoURL, ns.Name).Add(float64(ns.Deleted))
+		deleteErrors.WithLabelValues(ns.OktetoURL, ns.Name).Add(float64(ns.DeleteErrors))
+		reclaimed.WithLabelValues(ns.OktetoURL, ns.Name).Add(float64(ns.ReclaimedBytes))
+		for reason, count := range ns.Skipped {
+			skipped.WithLabelValues(ns.OktetoURL, ns.Name, reason).Add(float64(count))
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(deleted, skipped, deleteErrors, reclaimed, duration)
+
+	return push.New(url, jobName).
+		Grouping("dry_run", strconv.FormatBool(dryRun)).
+		Gatherer(registry).
+		PushContext(ctx)
+}
@@ -1,7 +1,43 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
+// Statuses of an Okteto namespace
+const (
+	namespaceStatusSleeping     = "Sleeping"
+	namespaceStatusDeleting     = "Deleting"
+	namespaceStatusDeleteFailed = "DeleteFailed"
+)
+
 // Namespace represents an Okteto namespace
 type Namespace struct {
-	Name   string `json:"name"`
+	Name string `json:"name"`
+
+	// Status is the status of the namespace in Okteto, such as "Active" or "Sleeping"
 	Status string `json:"status"`
+
+	// Type is the type of the namespace, such as "development" or "preview"
+	Type string `json:"type"`
+
+	// Persistent is true if Okteto never puts the namespace to sleep
+	Persistent bool `json:"persistent"`
+
+	// Personal is true for the personal namespace Okteto creates for each user, and false for the namespaces shared by a team
+	Personal bool `json:"personal"`
+
+	// LastUpdated is the last time the namespace had activity, as tracked by Okteto
+	LastUpdated time.Time `json:"lastUpdated"`
+}
+
+// IsSleeping returns true if Okteto put the namespace to sleep, scaling its pods to zero
+func (n Namespace) IsSleeping() bool {
+	return strings.EqualFold(n.Status, namespaceStatusSleeping)
+}
+
+// IsDeleting returns true if Okteto is deleting the namespace, or failed to delete it
+func (n Namespace) IsDeleting() bool {
+	return strings.EqualFold(n.Status, namespaceStatusDeleting) || strings.EqualFold(n.Status, namespaceStatusDeleteFailed)
 }
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNamespaceDecode(t *testing.T) {
+	data, err := os.ReadFile("testdata/namespaces.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var namespaces []Namespace
+	if err := json.Unmarshal(data, &namespaces); err != nil {
+		t.Fatalf("decoding the response of the Okteto API: %s", err)
+	}
+
+	tests := []struct {
+		want         Namespace
+		wantSleeping bool
+		wantDeleting bool
+	}{
+		{
+			want: Namespace{Name: "cindy", Status: "Active", Type: "development", Personal: true, LastUpdated: time.Date(2024, 5, 14, 9, 21, 43, 0, time.UTC)},
+		},
+		{
+			want:         Namespace{Name: "payments-team", Status: "Sleeping", Type: "development", LastUpdated: time.Date(2024, 5, 2, 18, 7, 12, 512000000, time.UTC)},
+			wantSleeping: true,
+		},
+		{
+			want:         Namespace{Name: "ramiro", Status: "Deleting", Type: "development", Personal: true, LastUpdated: time.Date(2024, 5, 13, 22, 45, 0, 0, time.UTC)},
+			wantDeleting: true,
+		},
+		{
+			want:         Namespace{Name: "staging", Status: "DeleteFailed", Type: "development", Persistent: true, LastUpdated: time.Date(2024, 4, 30, 4, 0, 0, 0, time.UTC)},
+			wantDeleting: true,
+		},
+	}
+
+	if len(namespaces) != len(tests) {
+		t.Fatalf("decoded %d namespaces, want %d", len(namespaces), len(tests))
+	}
+	for i, tt := range tests {
+		got := namespaces[i]
+		t.Run(tt.want.Name, func(t *testing.T) {
+			if got.Name != tt.want.Name || got.Status != tt.want.Status || got.Type != tt.want.Type || got.Persistent != tt.want.Persistent || got.Personal != tt.want.Personal {
+				t.Errorf("decoded %+v, want %+v", got, tt.want)
+			}
+			if !got.LastUpdated.Equal(tt.want.LastUpdated) {
+				t.Errorf("LastUpdated is %s, want %s", got.LastUpdated, tt.want.LastUpdated)
+			}
+			if got.IsSleeping() != tt.wantSleeping {
+				t.Errorf("IsSleeping() is %t, want %t", got.IsSleeping(), tt.wantSleeping)
+			}
+			if got.IsDeleting() != tt.wantDeleting {
+				t.Errorf("IsDeleting() is %t, want %t", got.IsDeleting(), tt.wantDeleting)
+			}
+		})
+	}
+}
+
+func TestNamespaceStatusIsCaseInsensitive(t *testing.T) {
+	if !(Namespace{Status: "sleeping"}).IsSleeping() {
+		t.Error("a namespace with status \"sleeping\" is not sleeping")
+	}
+	if !(Namespace{Status: "DELETING"}).IsDeleting() {
+		t.Error("a namespace with status \"DELETING\" is not being deleted")
+	}
+}
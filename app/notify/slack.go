@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Summary is the outcome of a cleanup run reported in the notifications
+type Summary struct {
+	// DryRun is true if the PVCs were not actually deleted
+	DryRun bool
+
+	// Namespaces is the number of namespaces processed
+	Namespaces int
+
+	// Deleted is the number of PVCs deleted
+	Deleted int
+
+	// Errors is the number of errors found during the run
+	Errors int
+
+	// Stuck is the number of deleted PVCs that still existed after the deletion timeout
+	Stuck int
+
+	// Reclaimed is the storage requested by the deleted PVCs, e.g. "45Gi"
+	Reclaimed string
+}
+
+// slackMessage is the payload accepted by Slack incoming webhooks
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// SendSlack posts a message summarizing the run to the given Slack incoming webhook
+func SendSlack(ctx context.Context, webhookURL string, summary Summary) error {
+	title := "Dev volumes cleanup finished"
+	deletedLabel := "PVCs deleted"
+	reclaimedLabel := "Storage reclaimed"
+	if summary.DryRun {
+		title = "Dev volumes cleanup finished (dry run)"
+		deletedLabel = "PVCs that would be deleted"
+		reclaimedLabel = "Storage that would be reclaimed"
+	}
+
+	msg := slackMessage{
+		Text: fmt.Sprintf("*%s*\n• Namespaces processed: %d\n• %s: %d\n• %s: %s\n• Errors: %d",
+			title, summary.Namespaces, deletedLabel, summary.Deleted, reclaimedLabel, summary.Reclaimed, summary.Errors),
+	}
+	if summary.Stuck > 0 {
+		msg.Text += fmt.Sprintf("\n• Still being deleted: %d", summary.Stuck)
+	}
+
+	return postJSON(ctx, webhookURL, msg)
+}
+
+// postJSON sends payload encoded as JSON to url
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("request failed with HTTP status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Report is the detailed outcome of a cleanup run sent to the generic webhook
+type Report struct {
+	// Timestamp is the time the run started
+	Timestamp time.Time `json:"timestamp"`
+
+	// OktetoURL is the comma-separated list of Okteto instances that were cleaned up
+	OktetoURL string `json:"oktetoURL"`
+
+	// DryRun is true if the PVCs were not actually deleted
+	DryRun bool `json:"dryRun"`
+
+	// Namespaces is the breakdown of the run per namespace
+	Namespaces []NamespaceReport `json:"namespaces"`
+}
+
+// NamespaceReport is the outcome of processing a namespace
+type NamespaceReport struct {
+	Name string `json:"name"`
+
+	// OktetoURL is the Okteto instance of the namespace
+	OktetoURL string `json:"oktetoURL"`
+
+	Deleted []string `json:"deleted"`
+
+	// Stuck are the deleted PVCs that still existed after the deletion timeout
+	Stuck []string `json:"stuck"`
+
+	Skipped []SkippedPVC `json:"skipped"`
+	Errors  []string     `json:"errors"`
+}
+
+// SkippedPVC is a dev PVC that was not deleted
+type SkippedPVC struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// SendWebhook posts the report of the run as JSON to the given URL
+func SendWebhook(ctx context.Context, url string, report Report) error {
+	return postJSON(ctx, url, report)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runScheduled runs the cleanup on the cron schedule of cfg until ctx is done. A run is skipped if the previous
+// one is still in progress. It returns the exit code of the process
+func runScheduled(ctx context.Context, cfg *config, health *healthServer, logger, summaryLogger *slog.Logger) int {
+	cronLog := cronLogger{logger: logger}
+	scheduler := cron.New(cron.WithLogger(cronLog), cron.WithChain(cron.SkipIfStillRunning(cronLog)))
+	if _, err := scheduler.AddFunc(cfg.schedule, func() {
+		logger.Info("Starting a scheduled run")
+		if code := cleanup(ctx, cfg, health, logger, summaryLogger); code != 0 {
+			logger.Warn(fmt.Sprintf("The scheduled run finished with exit code %d", code))
+		}
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Invalid value %q for SCHEDULE: %s", cfg.schedule, err))
+		return 1
+	}
+
+	scheduler.Start()
+	logger.Info(fmt.Sprintf("Running on schedule %q, the next run starts at %s", cfg.schedule, scheduler.Entries()[0].Next.Format(time.RFC3339)))
+
+	<-ctx.Done()
+	logger.Info("Received a shutdown signal, waiting for the current run to finish")
+	<-scheduler.Stop().Done()
+
+	return 0
+}
+
+// cronLogger writes the logs of the scheduler with the logger of the tool
+type cronLogger struct {
+	logger *slog.Logger
+}
+
+// Info logs a routine message of the scheduler. They are only shown at debug level
+func (l cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+// Error logs an error of the scheduler
+func (l cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, append(keysAndValues, "error", err)...)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// Build information, set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// versionString returns the build information printed by --version
+func versionString() string {
+	return fmt.Sprintf("delete-unused-dev-volumes %s (commit %s, built %s)", version, commit, date)
+}